@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+//go:embed embed/bench/positions.txt
+var _BenchPositions string
+
+const (
+	BenchDepth = 7
+	BenchHash  = 16
+)
+
+func BenchPositions() []string {
+	positions := []string(nil)
+
+	for _, line := range strings.Split(_BenchPositions, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			positions = append(positions, line)
+		}
+	}
+
+	return positions
+}
+
+type BenchResult struct {
+	Nodes   int
+	Elapsed time.Duration
+}
+
+func (r BenchResult) NPS() int {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return int(float64(r.Nodes) / r.Elapsed.Seconds())
+}
+
+// Bench searches every embedded position to a fixed depth with a fresh
+// transposition table and single thread, so the total node count acts as a
+// signature of the search that only changes when its behaviour does.
+func Bench(ctx context.Context, w io.Writer, depth, hash int) (BenchResult, error) {
+	total := BenchResult{}
+	positions := BenchPositions()
+
+	for i, fen := range positions {
+		game, err := GameFromFEN(fen)
+		if err != nil {
+			return total, fmt.Errorf("invalid bench position %d: %w", i+1, err)
+		}
+
+		sctx := &SearchContext{
+			Context:    ctx,
+			Game:       game,
+			TT:         NewTranspositionTable(uintptr(hash) * 1024 * 1024),
+			Threads:    1,
+			Heuristics: &SearchHeuristics{},
+			Limits: SearchLimits{
+				Depth: depth,
+			},
+			Options: SearchOptions{
+				PVS:                true,
+				NullMovePruning:    true,
+				LateMoveReductions: true,
+			},
+		}
+
+		Search(sctx)
+
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		elapsed := time.Since(sctx.Start)
+
+		total.Nodes += sctx.Nodes()
+		total.Elapsed += elapsed
+
+		fmt.Fprintf(w, "position %d/%d: %s\n", i+1, len(positions), fen)
+		fmt.Fprintf(w, "  bestmove %s nodes %d time %dms\n", sctx.Best, sctx.Nodes(), elapsed.Milliseconds())
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Total time (ms) : %d\n", total.Elapsed.Milliseconds())
+	fmt.Fprintf(w, "Nodes searched  : %d\n", total.Nodes)
+	fmt.Fprintf(w, "Nodes/second    : %d\n", total.NPS())
+
+	return total, nil
+}
+
+type BenchRunner struct {
+	Depth  int `help:"Depth to search each position to" default:"7"`
+	Hash   int `help:"Size of the transposition table in megabytes" default:"16"`
+	Expect int `help:"Expected total node count, exits with an error on mismatch"`
+}
+
+func (r *BenchRunner) Run(ctx context.Context) error {
+	result, err := Bench(ctx, os.Stdout, r.Depth, r.Hash)
+	if err != nil {
+		return err
+	}
+
+	if r.Expect != 0 && result.Nodes != r.Expect {
+		return fmt.Errorf("bench signature mismatch: expected %d nodes, got %d", r.Expect, result.Nodes)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchPositions(t *testing.T) {
+	positions := BenchPositions()
+	require.NotEmpty(t, positions)
+
+	for _, fen := range positions {
+		_, err := BoardFromFEN(fen)
+		assert.NoError(t, err, fen)
+	}
+}
+
+func TestBenchDeterministic(t *testing.T) {
+	first, err := Bench(context.Background(), io.Discard, 3, 1)
+	require.NoError(t, err)
+
+	second, err := Bench(context.Background(), io.Discard, 3, 1)
+	require.NoError(t, err)
+
+	assert.NotZero(t, first.Nodes)
+	assert.Equal(t, first.Nodes, second.Nodes)
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type PerftDivide map[string]uint64
+
+// ReadPerftDivide parses divide output in the "move: count" format written by
+// Perft. Lines without a move, such as totals, are skipped.
+func ReadPerftDivide(r io.Reader) (PerftDivide, error) {
+	divide := PerftDivide{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), ":", " ", 1))
+		if len(fields) != 2 {
+			continue
+		}
+
+		if len(fields[0]) < 4 || len(fields[0]) > 5 {
+			continue
+		}
+
+		if _, ok := SquareFromString(fields[0][:2]); !ok {
+			continue
+		}
+
+		nodes, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid count for %s: %s", fields[0], fields[1])
+		}
+
+		divide[fields[0]] = nodes
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return divide, nil
+}
+
+type PerftBisection struct {
+	// Path is the moves played from the starting position to reach FEN.
+	Path  []string
+	FEN   string
+	Depth int
+
+	Missing []string
+	Extra   []string
+
+	// Expected and Got are set when the moves match but a count at depth one
+	// below differs, which only happens when the reference is inconsistent.
+	Expected uint64
+	Got      uint64
+}
+
+// Found reports whether the bisection located a mismatch.
+func (pb PerftBisection) Found() bool {
+	return len(pb.Missing) > 0 || len(pb.Extra) > 0 || pb.Expected != pb.Got
+}
+
+// BisectPerft compares our divide against a reference divide for the game's
+// position and descends into the first child whose count differs. Below the
+// root the reference comes from a slow but independent move generator, so the
+// search ends at the smallest position where the move lists disagree.
+func BisectPerft(game *Game, depth int, reference PerftDivide, log io.Writer) (PerftBisection, error) {
+	return bisectPerft(game, depth, reference, log, GenerateMoves)
+}
+
+func bisectPerft(game *Game, depth int, reference PerftDivide, log io.Writer, generate func(*Board, MoveGenerationOptions) []Move) (PerftBisection, error) {
+	result := PerftBisection{}
+
+	for {
+		result.FEN = game.FEN()
+		result.Depth = depth
+
+		ours := perftDivide(game, depth, generate)
+
+		result.Missing, result.Extra = nil, nil
+
+		for move := range reference {
+			if _, ok := ours[move]; !ok {
+				result.Missing = append(result.Missing, move)
+			}
+		}
+
+		for move := range ours {
+			if _, ok := reference[move]; !ok {
+				result.Extra = append(result.Extra, move)
+			}
+		}
+
+		slices.Sort(result.Missing)
+		slices.Sort(result.Extra)
+
+		if result.Found() {
+			return result, nil
+		}
+
+		next := ""
+
+		for _, move := range slices.Sorted(maps.Keys(ours)) {
+			if ours[move] != reference[move] {
+				next = move
+				break
+			}
+		}
+
+		if next == "" {
+			return result, nil
+		}
+
+		if depth == 1 {
+			result.Expected, result.Got = reference[next], ours[next]
+			return result, nil
+		}
+
+		if log != nil {
+			fmt.Fprintf(log, "%s: expected %d, got %d\n", next, reference[next], ours[next])
+		}
+
+		if err := game.MakeUCIMove(next); err != nil {
+			return result, fmt.Errorf("failed to play %s from %s: %w", next, result.FEN, err)
+		}
+
+		result.Path = append(result.Path, next)
+
+		depth--
+		reference = perftDivide(game, depth, ReferenceMoves)
+	}
+}
+
+func perftDivide(game *Game, depth int, generate func(*Board, MoveGenerationOptions) []Move) PerftDivide {
+	divide := PerftDivide{}
+
+	for _, move := range generate(game.Board(), MoveGenerationOptions{}) {
+		game.MakeMove(move)
+		divide[move.String()] = referencePerft(game, depth-1, generate)
+		game.UnmakeMove()
+	}
+
+	return divide
+}
+
+func referencePerft(game *Game, depth int, generate func(*Board, MoveGenerationOptions) []Move) uint64 {
+	if depth == 0 {
+		return 1
+	}
+
+	total := uint64(0)
+
+	for _, move := range generate(game.Board(), MoveGenerationOptions{}) {
+		game.MakeMove(move)
+		total += referencePerft(game, depth-1, generate)
+		game.UnmakeMove()
+	}
+
+	return total
+}
+
+// ReferenceMoves is a deliberately simple legal move generator that shares
+// nothing with GenerateMoves beyond making moves on the board. It walks the
+// board square by square, generates pseudo-legal moves and drops those that
+// leave the king attacked, which is slow but easy to check by eye.
+func ReferenceMoves(b *Board, _ MoveGenerationOptions) []Move {
+	moves := []Move(nil)
+
+	for from := range Squares() {
+		piece := b.Squares[from]
+		if piece == EmptySquare || piece.Color() != b.Player {
+			continue
+		}
+
+		for _, move := range referencePseudoMoves(b, from, piece) {
+			next := *b
+			next.Make(move)
+
+			if !referenceAttacked(&next, next.Kings[b.Player], next.Player) {
+				moves = append(moves, move)
+			}
+		}
+	}
+
+	return moves
+}
+
+var (
+	referenceKnight   = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	referenceKing     = [][2]int{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+	referenceRook     = [][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}}
+	referenceBishop   = [][2]int{{1, 1}, {1, -1}, {-1, -1}, {-1, 1}}
+	referencePromotes = []MoveFlags{MoveFlagPromoteToQueen, MoveFlagPromoteToRook, MoveFlagPromoteToBishop, MoveFlagPromoteToKnight}
+)
+
+func referenceSquare(sq Square, df, dr int) (Square, bool) {
+	file, rank := int(sq.File())+df, int(sq.Rank())+dr
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return 0, false
+	}
+
+	return NewSquare(File(file), Rank(rank)), true
+}
+
+func referencePseudoMoves(b *Board, from Square, piece Piece) []Move {
+	moves := []Move(nil)
+	color := piece.Color()
+
+	add := func(to Square) bool {
+		target := b.Squares[to]
+
+		switch {
+		case target == EmptySquare:
+			moves = append(moves, NewMove(from, to))
+			return true
+
+		case target.Color() != color:
+			moves = append(moves, NewMove(from, to, MoveFlagCapture))
+		}
+
+		return false
+	}
+
+	steps := func(deltas [][2]int, slide bool) {
+		for _, d := range deltas {
+			to, ok := referenceSquare(from, d[0], d[1])
+
+			for ok && add(to) && slide {
+				to, ok = referenceSquare(to, d[0], d[1])
+			}
+		}
+	}
+
+	switch piece.Type() {
+	case Knight:
+		steps(referenceKnight, false)
+
+	case Bishop:
+		steps(referenceBishop, true)
+
+	case Rook:
+		steps(referenceRook, true)
+
+	case Queen:
+		steps(referenceRook, true)
+		steps(referenceBishop, true)
+
+	case King:
+		steps(referenceKing, false)
+		moves = append(moves, referenceCastling(b, from, color)...)
+
+	case Pawn:
+		moves = append(moves, referencePawnMoves(b, from, color)...)
+	}
+
+	return moves
+}
+
+func referencePawnMoves(b *Board, from Square, color Color) []Move {
+	moves := []Move(nil)
+
+	forward, start, last := 1, Rank2, Rank8
+	if color == Black {
+		forward, start, last = -1, Rank7, Rank1
+	}
+
+	add := func(move Move) {
+		if move.To.Rank() != last {
+			moves = append(moves, move)
+			return
+		}
+
+		for _, promotion := range referencePromotes {
+			moves = append(moves, NewMove(move.From, move.To, move.Flags, promotion))
+		}
+	}
+
+	if to, ok := referenceSquare(from, 0, forward); ok && b.Squares[to] == EmptySquare {
+		add(NewMove(from, to))
+
+		if two, ok := referenceSquare(to, 0, forward); ok && from.Rank() == start && b.Squares[two] == EmptySquare {
+			add(NewMove(from, two, MoveFlagDoublePawnPush))
+		}
+	}
+
+	for _, df := range []int{-1, 1} {
+		to, ok := referenceSquare(from, df, forward)
+		if !ok {
+			continue
+		}
+
+		if target := b.Squares[to]; target != EmptySquare && target.Color() != color {
+			add(NewMove(from, to, MoveFlagCapture))
+		} else if b.EnPassant != 0 && to == b.EnPassant && target == EmptySquare {
+			add(NewMove(from, to, MoveFlagCapture, MoveFlagCaptureEnPassant))
+		}
+	}
+
+	return moves
+}
+
+func referenceCastling(b *Board, from Square, color Color) []Move {
+	moves := []Move(nil)
+	opponent := color.Opponent()
+
+	rank := Rank1
+	if color == Black {
+		rank = Rank8
+	}
+
+	if from != NewSquare(FileE, rank) || referenceAttacked(b, from, opponent) {
+		return nil
+	}
+
+	sides := []struct {
+		allowed bool
+		empty   []File
+		safe    []File
+		to      File
+		flag    MoveFlags
+	}{
+		{b.Castling[color].Kingside, []File{FileF, FileG}, []File{FileF, FileG}, FileG, MoveFlagCastleKingside},
+		{b.Castling[color].Queenside, []File{FileB, FileC, FileD}, []File{FileC, FileD}, FileC, MoveFlagCastleQueenside},
+	}
+
+	for _, side := range sides {
+		if !side.allowed {
+			continue
+		}
+
+		ok := true
+
+		for _, file := range side.empty {
+			ok = ok && b.Squares[NewSquare(file, rank)] == EmptySquare
+		}
+
+		for _, file := range side.safe {
+			ok = ok && !referenceAttacked(b, NewSquare(file, rank), opponent)
+		}
+
+		if ok {
+			moves = append(moves, NewMove(from, NewSquare(side.to, rank), side.flag))
+		}
+	}
+
+	return moves
+}
+
+// referenceAttacked reports whether sq is attacked by any piece of attacker.
+func referenceAttacked(b *Board, sq Square, attacker Color) bool {
+	is := func(df, dr int, types ...PieceType) bool {
+		to, ok := referenceSquare(sq, df, dr)
+		if !ok {
+			return false
+		}
+
+		piece := b.Squares[to]
+
+		return piece != EmptySquare && piece.Color() == attacker && slices.Contains(types, piece.Type())
+	}
+
+	slides := func(deltas [][2]int, types ...PieceType) bool {
+		for _, d := range deltas {
+			to, ok := referenceSquare(sq, d[0], d[1])
+
+			for ok {
+				if piece := b.Squares[to]; piece != EmptySquare {
+					if piece.Color() == attacker && slices.Contains(types, piece.Type()) {
+						return true
+					}
+
+					break
+				}
+
+				to, ok = referenceSquare(to, d[0], d[1])
+			}
+		}
+
+		return false
+	}
+
+	for _, d := range referenceKnight {
+		if is(d[0], d[1], Knight) {
+			return true
+		}
+	}
+
+	for _, d := range referenceKing {
+		if is(d[0], d[1], King) {
+			return true
+		}
+	}
+
+	// pawns attack towards the opponent, so look back the way they came
+	back := -1
+	if attacker == Black {
+		back = 1
+	}
+
+	if is(-1, back, Pawn) || is(1, back, Pawn) {
+		return true
+	}
+
+	return slides(referenceRook, Rook, Queen) || slides(referenceBishop, Bishop, Queen)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceMoves(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen, test := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			depth := min(len(test)-1, 3)
+
+			assert.Equal(t, test[depth], referencePerft(game, depth, ReferenceMoves))
+		})
+	}
+}
+
+func TestReadPerftDivide(t *testing.T) {
+	input := strings.Join([]string{
+		" a2a3: 380",
+		"b7b8q: 12",
+		"e2e4 600",
+		"",
+		"Nodes searched: 992",
+	}, "\n")
+
+	divide, err := ReadPerftDivide(strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, PerftDivide{"a2a3": 380, "b7b8q": 12, "e2e4": 600}, divide)
+
+	_, err = ReadPerftDivide(strings.NewReader("a2a3: lots"))
+	assert.Error(t, err)
+}
+
+func TestBisectPerft(t *testing.T) {
+	const fen = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+	reference := func(t *testing.T, depth int) PerftDivide {
+		game, err := GameFromFEN(fen)
+		require.NoError(t, err)
+
+		out := bytes.Buffer{}
+		Perft(game, depth, &out)
+
+		divide, err := ReadPerftDivide(&out)
+		require.NoError(t, err)
+
+		return divide
+	}
+
+	t.Run("match", func(t *testing.T) {
+		game, err := GameFromFEN(fen)
+		require.NoError(t, err)
+
+		result, err := BisectPerft(game, 3, reference(t, 3), nil)
+		require.NoError(t, err)
+
+		assert.False(t, result.Found())
+		assert.Empty(t, result.Path)
+	})
+
+	t.Run("missing root move", func(t *testing.T) {
+		game, err := GameFromFEN(fen)
+		require.NoError(t, err)
+
+		divide := reference(t, 2)
+		divide["a1a3"] = 1
+
+		result, err := BisectPerft(game, 2, divide, nil)
+		require.NoError(t, err)
+
+		assert.True(t, result.Found())
+		assert.Equal(t, []string{"a1a3"}, result.Missing)
+		assert.Empty(t, result.Path)
+	})
+
+	t.Run("buggy generator", func(t *testing.T) {
+		game, err := GameFromFEN(fen)
+		require.NoError(t, err)
+
+		// a generator that forgets en passant only goes wrong a couple of
+		// plies in, after a double push next to one of white's pawns
+		generate := func(b *Board, opts MoveGenerationOptions) []Move {
+			moves := GenerateMoves(b, opts)
+
+			for i, move := range moves {
+				if move.Flags&MoveFlagCaptureEnPassant != 0 {
+					return append(moves[:i:i], moves[i+1:]...)
+				}
+			}
+
+			return moves
+		}
+
+		result, err := bisectPerft(game, 3, reference(t, 3), nil, generate)
+		require.NoError(t, err)
+
+		require.True(t, result.Found())
+		assert.Len(t, result.Path, 2)
+		assert.Equal(t, 1, result.Depth)
+		assert.Len(t, result.Missing, 1)
+		assert.Empty(t, result.Extra)
+
+		board, err := BoardFromFEN(result.FEN)
+		require.NoError(t, err)
+		assert.NotZero(t, board.EnPassant)
+
+		move, err := ParseUCIMove(&board, result.Missing[0])
+		require.NoError(t, err)
+		assert.NotZero(t, move.Flags&MoveFlagCaptureEnPassant)
+	})
+	t.Run("illegal move", func(t *testing.T) {
+		game, err := GameFromFEN(fen)
+		require.NoError(t, err)
+
+		// both sides agree on a move the real generator doesn't know about
+		generate := func(b *Board, opts MoveGenerationOptions) []Move {
+			moves := GenerateMoves(b, opts)
+
+			if b.Player == White {
+				moves = append(moves, NewMove(SquareA2, SquareA5))
+			}
+
+			return moves
+		}
+
+		divide := reference(t, 2)
+		divide["a2a5"] = 1
+
+		_, err = bisectPerft(game, 2, divide, nil, generate)
+		assert.ErrorIs(t, err, ErrInvalidMove)
+	})
+}
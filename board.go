@@ -39,50 +39,89 @@ const BoardStartPos = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
 var ErrInvalidFEN = fmt.Errorf("invalid fen")
 
+type FENOptions struct {
+	// Lenient accepts positions that cannot arise in a game, such as the side
+	// not to move being in check. Castling rights and en passant targets that
+	// do not match the position are dropped rather than rejected, and the move
+	// counters may be omitted. Pawns on the back ranks are always rejected, as
+	// move generation assumes they can't exist.
+	Lenient bool
+}
+
 func BoardFromFEN(fen string) (Board, error) {
+	return BoardFromFENOptions(fen, FENOptions{})
+}
+
+func BoardFromFENOptions(fen string, opts FENOptions) (Board, error) {
 	b := Board{}
 
 	fields := strings.Fields(fen)
+	if opts.Lenient && len(fields) == 4 {
+		fields = append(fields, "0", "1")
+	}
+
 	if len(fields) != 6 {
 		return Board{}, fmt.Errorf("%w: expected 6 fields, got %d", ErrInvalidFEN, len(fields))
 	}
 
-	pieces := fields[0]
-
-	for rank := range RanksReversed() {
-		if rank < RankLast {
-			if pieces[0] != '/' {
-				return Board{}, fmt.Errorf("%w: missing slash: %s", ErrInvalidFEN, pieces)
-			}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != RankCount {
+		return Board{}, fmt.Errorf("%w: expected %d ranks, got %d", ErrInvalidFEN, RankCount, len(ranks))
+	}
 
-			pieces = pieces[1:]
-		}
+	kings := [ColorCount]int{}
 
-		for file := FileFirst; file <= FileLast; file++ {
-			ch := pieces[0]
-			pieces = pieces[1:]
+	for i, pieces := range ranks {
+		rank := RankLast - Rank(i)
+		file := FileFirst
 
+		for _, ch := range pieces {
 			if ch >= '1' && ch <= '8' {
-				file += File(ch-'0') - 1
+				if file += File(ch - '0'); file > FileCount {
+					return Board{}, fmt.Errorf("%w: too many files on rank %s: %s", ErrInvalidFEN, rank, pieces)
+				}
+
 				continue
 			}
 
+			if file > FileLast {
+				return Board{}, fmt.Errorf("%w: too many files on rank %s: %s", ErrInvalidFEN, rank, pieces)
+			}
+
 			pc, ok := PieceFromString(string(ch))
 			if !ok {
 				return Board{}, fmt.Errorf("%w: invalid piece: %s", ErrInvalidFEN, string(ch))
 			}
 
 			sq := NewSquare(file, rank)
+			file++
 
 			b.Squares[sq] = pc
 
 			b.Bits.Players[pc.Color()] = b.Bits.Players[pc.Color()].Occupy(sq)
 			b.Bits.Pieces[pc.Type()] = b.Bits.Pieces[pc.Type()].Occupy(sq)
 
-			if pc.Type() == King {
+			switch pc.Type() {
+			case King:
 				b.Kings[pc.Color()] = sq
+				kings[pc.Color()]++
+
+			case Pawn:
+				if rank == Rank1 || rank == Rank8 {
+					return Board{}, fmt.Errorf("%w: pawn on back rank: %s", ErrInvalidFEN, sq)
+				}
 			}
 		}
+
+		if file != FileCount {
+			return Board{}, fmt.Errorf("%w: expected %d files on rank %s, got %d: %s", ErrInvalidFEN, FileCount, rank, file, pieces)
+		}
+	}
+
+	for color, n := range kings {
+		if n != 1 {
+			return Board{}, fmt.Errorf("%w: expected 1 %s king, got %d", ErrInvalidFEN, Color(color), n)
+		}
 	}
 
 	b.Bits.All = b.Bits.Players[White].Set(b.Bits.Players[Black])
@@ -94,6 +133,10 @@ func BoardFromFEN(fen string) (Board, error) {
 
 	b.Player = player
 
+	if !opts.Lenient && GenerateAttacks(&b, b.Player).Checks > 0 {
+		return Board{}, fmt.Errorf("%w: %s is in check but not to move", ErrInvalidFEN, b.Player.Opponent())
+	}
+
 	if fields[2] != "-" {
 		for _, c := range fields[2] {
 			switch c {
@@ -115,21 +158,56 @@ func BoardFromFEN(fen string) (Board, error) {
 		}
 	}
 
+	for _, castling := range [...]struct {
+		color  Color
+		right  *bool
+		king   Square
+		rook   Square
+		symbol string
+	}{
+		{White, &b.Castling[White].Kingside, SquareE1, SquareH1, "K"},
+		{White, &b.Castling[White].Queenside, SquareE1, SquareA1, "Q"},
+		{Black, &b.Castling[Black].Kingside, SquareE8, SquareH8, "k"},
+		{Black, &b.Castling[Black].Queenside, SquareE8, SquareA8, "q"},
+	} {
+		if !*castling.right {
+			continue
+		}
+
+		if b.Squares[castling.king] == NewPiece(castling.color, King) && b.Squares[castling.rook] == NewPiece(castling.color, Rook) {
+			continue
+		}
+
+		if !opts.Lenient {
+			return Board{}, fmt.Errorf("%w: castling right %s without king and rook on %s and %s", ErrInvalidFEN, castling.symbol, castling.king, castling.rook)
+		}
+
+		*castling.right = false
+	}
+
 	if fields[3] != "-" {
 		if b.EnPassant, ok = SquareFromString(fields[3]); !ok {
 			return Board{}, fmt.Errorf("%w: invalid en passant target: %s", ErrInvalidFEN, fields[3])
 		}
+
+		if err := validateEnPassant(&b); err != nil {
+			if !opts.Lenient {
+				return Board{}, err
+			}
+
+			b.EnPassant = 0
+		}
 	}
 
 	half, err := strconv.Atoi(fields[4])
-	if err != nil {
+	if err != nil || half < 0 {
 		return Board{}, fmt.Errorf("%w: invalid half moves: %s", ErrInvalidFEN, fields[4])
 	}
 
 	b.Moves.Half = half
 
 	full, err := strconv.Atoi(fields[5])
-	if err != nil {
+	if err != nil || full < 1 {
 		return Board{}, fmt.Errorf("%w: invalid full moves: %s", ErrInvalidFEN, fields[5])
 	}
 
@@ -141,6 +219,29 @@ func BoardFromFEN(fen string) (Board, error) {
 	return b, nil
 }
 
+func validateEnPassant(b *Board) error {
+	rank, forward := Rank6, South
+	if b.Player == Black {
+		rank, forward = Rank3, North
+	}
+
+	if b.EnPassant.Rank() != rank {
+		return fmt.Errorf("%w: en passant target on impossible rank: %s", ErrInvalidFEN, b.EnPassant)
+	}
+
+	pawn := b.EnPassant + forward.Offset()
+
+	if b.Squares[pawn] != NewPiece(b.Player.Opponent(), Pawn) {
+		return fmt.Errorf("%w: en passant target without pawn on %s: %s", ErrInvalidFEN, pawn, b.EnPassant)
+	}
+
+	if b.Squares[b.EnPassant] != EmptySquare || b.Squares[b.EnPassant-forward.Offset()] != EmptySquare {
+		return fmt.Errorf("%w: en passant target with occupied squares: %s", ErrInvalidFEN, b.EnPassant)
+	}
+
+	return nil
+}
+
 func (b Board) String() string {
 	s := strings.Builder{}
 
@@ -182,148 +283,324 @@ func (b Board) String() string {
 	return s.String()
 }
 
+func (b *Board) FEN() string {
+	s := strings.Builder{}
+
+	for rank := range RanksReversed() {
+		if rank < RankLast {
+			s.WriteByte('/')
+		}
+
+		empty := 0
+
+		for file := range Files() {
+			piece := b.Squares[NewSquare(file, rank)]
+			if piece == EmptySquare {
+				empty++
+				continue
+			}
+
+			if empty > 0 {
+				s.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+
+			s.WriteString(piece.String())
+		}
+
+		if empty > 0 {
+			s.WriteString(strconv.Itoa(empty))
+		}
+	}
+
+	s.WriteByte(' ')
+	s.WriteString(b.Player.String())
+	s.WriteByte(' ')
+
+	castling := s.Len()
+
+	if b.Castling[White].Kingside {
+		s.WriteByte('K')
+	}
+
+	if b.Castling[White].Queenside {
+		s.WriteByte('Q')
+	}
+
+	if b.Castling[Black].Kingside {
+		s.WriteByte('k')
+	}
+
+	if b.Castling[Black].Queenside {
+		s.WriteByte('q')
+	}
+
+	if s.Len() == castling {
+		s.WriteByte('-')
+	}
+
+	s.WriteByte(' ')
+
+	if b.EnPassant != 0 {
+		s.WriteString(b.EnPassant.String())
+	} else {
+		s.WriteByte('-')
+	}
+
+	fmt.Fprintf(&s, " %d %d", b.Moves.Half, b.Moves.Full)
+
+	return s.String()
+}
+
+type BoardUndo struct {
+	Captured  Piece
+	Castling  [ColorCount]BoardCastlingRights
+	EnPassant Square
+	Half      int
+	Last      Move
+	Zobrist   Zobrist
+	Attacks   Attacks
+}
+
 func (b Board) MakeMove(move Move) Board {
+	b.Make(move)
+
+	return b
+}
+
+func (b Board) MakeNullMove() Board {
+	b.MakeNull()
+
+	return b
+}
+
+func (b *Board) Make(move Move) BoardUndo {
+	undo := BoardUndo{
+		Castling:  b.Castling,
+		EnPassant: b.EnPassant,
+		Half:      b.Moves.Half,
+		Last:      b.Moves.Last,
+		Zobrist:   b.Zobrist,
+		Attacks:   b.Attacks,
+	}
+
 	piece := b.Squares[move.From]
 	ptype := piece.Type()
 	color := piece.Color()
 
 	if b.EnPassant != 0 {
-		b.Zobrist ^= Zobrists.EnPassant[b.EnPassant.File()]
+		b.Zobrist ^= Zobrists.EnPassant[b.EnPassant]
 		b.EnPassant = 0
 	}
 
 	b.Zobrist ^= Zobrists.Players[b.Player]
-	b.Zobrist ^= Zobrists.Pieces[color][ptype][move.From]
-	b.Zobrist ^= Zobrists.Castling[CastlingZobristIndex(&b)]
+	b.Zobrist ^= Zobrists.Castling[CastlingZobristIndex(b)]
 
 	if ptype == Pawn || move.Flags&MoveFlagCapture != 0 {
-		b.Moves.Half = 1
+		b.Moves.Half = 0
 	} else {
 		b.Moves.Half++
 	}
 
+	if move.Flags&MoveFlagCapture != 0 {
+		target := move.To
+
+		if move.Flags&MoveFlagCaptureEnPassant != 0 {
+			target = NewSquare(move.To.File(), move.From.Rank())
+		}
+
+		undo.Captured = b.Squares[target]
+
+		b.remove(target)
+		b.Zobrist ^= Zobrists.Pieces[color.Opponent()][undo.Captured.Type()][target]
+
+		b.revokeCastling(target)
+	}
+
+	b.remove(move.From)
+	b.Zobrist ^= Zobrists.Pieces[color][ptype][move.From]
+
+	if promotion, ok := move.Promotion(); ok {
+		piece = NewPiece(color, promotion)
+		ptype = promotion
+	}
+
+	b.put(move.To, piece)
+	b.Zobrist ^= Zobrists.Pieces[color][ptype][move.To]
+
 	switch ptype {
 	case King:
 		b.Kings[color] = move.To
 		b.Castling[color] = BoardCastlingRights{}
 
 		if move.Flags&MoveFlagCastleAny != 0 {
-			rook := Move{}
-
-			if move.Flags&MoveFlagCastleKingside != 0 {
-				if color == White {
-					rook = Move{From: SquareH1, To: SquareF1}
-				} else {
-					rook = Move{From: SquareH8, To: SquareF8}
-				}
-			} else if move.Flags&MoveFlagCastleQueenside != 0 {
-				if color == White {
-					rook = Move{From: SquareA1, To: SquareD1}
-				} else {
-					rook = Move{From: SquareA8, To: SquareD8}
-				}
-			}
+			rook := CastlingRookMove(move)
 
-			b.Squares[rook.To] = b.Squares[rook.From]
-			b.Squares[rook.From] = EmptySquare
-
-			b.Bits.Players[color] = b.Bits.Players[color].Unoccupy(rook.From)
-			b.Bits.Players[color] = b.Bits.Players[color].Occupy(rook.To)
-
-			b.Bits.Pieces[Rook] = b.Bits.Pieces[Rook].Unoccupy(rook.From)
-			b.Bits.Pieces[Rook] = b.Bits.Pieces[Rook].Occupy(rook.To)
+			b.remove(rook.From)
+			b.put(rook.To, NewPiece(color, Rook))
 
 			b.Zobrist ^= Zobrists.Pieces[color][Rook][rook.From]
 			b.Zobrist ^= Zobrists.Pieces[color][Rook][rook.To]
 		}
 
 	case Rook:
-		if move.From == SquareA1 || move.From == SquareA8 {
-			b.Castling[color].Queenside = false
-		} else if move.From == SquareH1 || move.From == SquareH8 {
-			b.Castling[color].Kingside = false
-		}
+		b.revokeCastling(move.From)
 
 	case Pawn:
-		if promotion, ok := move.Promotion(); ok {
-			b.Bits.Pieces[Pawn] = b.Bits.Pieces[Pawn].Unoccupy(move.From)
-
-			piece = NewPiece(color, promotion)
-			ptype = promotion
-		} else if move.Flags&MoveFlagDoublePawnPush != 0 {
-			if color == White {
-				b.EnPassant = move.From + North.Offset()
-			} else {
-				b.EnPassant = move.From + South.Offset()
-			}
-
+		if move.Flags&MoveFlagDoublePawnPush != 0 {
+			b.EnPassant = NewSquare(move.From.File(), (move.From.Rank()+move.To.Rank())/2)
 			b.Zobrist ^= Zobrists.EnPassant[b.EnPassant]
-		} else if move.Flags&MoveFlagCaptureEnPassant != 0 {
-			target := move.To
+		}
+	}
 
-			if color == White {
-				target += South.Offset()
-			} else {
-				target += North.Offset()
-			}
+	b.Bits.All = b.Bits.Players[Black].Set(b.Bits.Players[White])
 
-			b.Squares[target] = EmptySquare
+	if color == Black {
+		b.Moves.Full++
+	}
 
-			b.Bits.All = b.Bits.All.Unoccupy(target)
-			b.Bits.Players[color.Opponent()] = b.Bits.Players[color.Opponent()].Unoccupy(target)
-			b.Bits.Pieces[Pawn] = b.Bits.Pieces[Pawn].Unoccupy(target)
+	b.Moves.Last = move
 
-			b.Zobrist ^= Zobrists.Pieces[color.Opponent()][Pawn][target]
-		}
-	}
+	b.Attacks = GenerateAttacks(b, b.Player)
+	b.Player = b.Player.Opponent()
 
-	if move.Flags&MoveFlagCapture != 0 {
-		switch move.To {
-		case SquareA1:
-			b.Castling[White].Queenside = false
+	b.Zobrist ^= Zobrists.Castling[CastlingZobristIndex(b)]
+	b.Zobrist ^= Zobrists.Players[b.Player]
 
-		case SquareH1:
-			b.Castling[White].Kingside = false
+	return undo
+}
 
-		case SquareA8:
-			b.Castling[Black].Queenside = false
+func (b *Board) Unmake(move Move, undo BoardUndo) {
+	b.Player = b.Player.Opponent()
+	color := b.Player
 
-		case SquareH8:
-			b.Castling[Black].Kingside = false
-		}
+	piece := b.Squares[move.To]
+	if move.Flags&MoveFlagPromoteAny != 0 {
+		piece = NewPiece(color, Pawn)
+	}
+
+	b.remove(move.To)
+	b.put(move.From, piece)
+
+	if piece.Type() == King {
+		b.Kings[color] = move.From
+
+		if move.Flags&MoveFlagCastleAny != 0 {
+			rook := CastlingRookMove(move)
 
-		if move.Flags&MoveFlagCaptureEnPassant == 0 {
-			b.Zobrist ^= Zobrists.Pieces[color.Opponent()][b.Squares[move.To].Type()][move.To]
+			b.remove(rook.To)
+			b.put(rook.From, NewPiece(color, Rook))
 		}
 	}
 
-	b.Squares[move.From] = EmptySquare
-	b.Squares[move.To] = piece
+	if move.Flags&MoveFlagCapture != 0 {
+		target := move.To
 
-	b.Bits.Players[color] = b.Bits.Players[color].Unoccupy(move.From)
-	b.Bits.Players[color] = b.Bits.Players[color].Occupy(move.To)
-	b.Bits.Players[color.Opponent()] = b.Bits.Players[color.Opponent()].Unoccupy(move.To)
+		if move.Flags&MoveFlagCaptureEnPassant != 0 {
+			target = NewSquare(move.To.File(), move.From.Rank())
+		}
 
-	for p := range b.Bits.Pieces {
-		b.Bits.Pieces[p] = b.Bits.Pieces[p].Unoccupy(move.To)
+		b.put(target, undo.Captured)
 	}
 
-	b.Bits.Pieces[ptype] = b.Bits.Pieces[ptype].Unoccupy(move.From)
-	b.Bits.Pieces[ptype] = b.Bits.Pieces[ptype].Occupy(move.To)
 	b.Bits.All = b.Bits.Players[Black].Set(b.Bits.Players[White])
 
 	if color == Black {
-		b.Moves.Full++
+		b.Moves.Full--
 	}
 
-	b.Moves.Last = move
+	b.Castling = undo.Castling
+	b.EnPassant = undo.EnPassant
+	b.Moves.Half = undo.Half
+	b.Moves.Last = undo.Last
+	b.Zobrist = undo.Zobrist
+	b.Attacks = undo.Attacks
+}
 
-	b.Attacks = GenerateAttacks(&b, b.Player)
+func (b *Board) MakeNull() BoardUndo {
+	undo := BoardUndo{
+		Castling:  b.Castling,
+		EnPassant: b.EnPassant,
+		Half:      b.Moves.Half,
+		Last:      b.Moves.Last,
+		Zobrist:   b.Zobrist,
+		Attacks:   b.Attacks,
+	}
+
+	if b.EnPassant != 0 {
+		b.Zobrist ^= Zobrists.EnPassant[b.EnPassant]
+		b.EnPassant = 0
+	}
+
+	b.Zobrist ^= Zobrists.Players[b.Player]
+
+	b.Moves.Half++
+	b.Moves.Last = Move{}
+
+	b.Attacks = GenerateAttacks(b, b.Player)
 	b.Player = b.Player.Opponent()
 
-	b.Zobrist ^= Zobrists.Pieces[color][ptype][move.To]
-	b.Zobrist ^= Zobrists.Castling[CastlingZobristIndex(&b)]
 	b.Zobrist ^= Zobrists.Players[b.Player]
 
-	return b
+	return undo
+}
+
+func (b *Board) UnmakeNull(undo BoardUndo) {
+	b.Player = b.Player.Opponent()
+
+	b.EnPassant = undo.EnPassant
+	b.Moves.Half = undo.Half
+	b.Moves.Last = undo.Last
+	b.Zobrist = undo.Zobrist
+	b.Attacks = undo.Attacks
+}
+
+func (b *Board) put(sq Square, piece Piece) {
+	b.Squares[sq] = piece
+
+	b.Bits.Players[piece.Color()] = b.Bits.Players[piece.Color()].Occupy(sq)
+	b.Bits.Pieces[piece.Type()] = b.Bits.Pieces[piece.Type()].Occupy(sq)
+}
+
+func (b *Board) remove(sq Square) {
+	piece := b.Squares[sq]
+
+	b.Squares[sq] = EmptySquare
+
+	b.Bits.Players[piece.Color()] = b.Bits.Players[piece.Color()].Unoccupy(sq)
+	b.Bits.Pieces[piece.Type()] = b.Bits.Pieces[piece.Type()].Unoccupy(sq)
+}
+
+func (b *Board) revokeCastling(sq Square) {
+	switch sq {
+	case SquareA1:
+		b.Castling[White].Queenside = false
+
+	case SquareH1:
+		b.Castling[White].Kingside = false
+
+	case SquareA8:
+		b.Castling[Black].Queenside = false
+
+	case SquareH8:
+		b.Castling[Black].Kingside = false
+	}
+}
+
+func CastlingRookMove(move Move) Move {
+	switch move.To {
+	case SquareG1:
+		return Move{From: SquareH1, To: SquareF1}
+
+	case SquareC1:
+		return Move{From: SquareA1, To: SquareD1}
+
+	case SquareG8:
+		return Move{From: SquareH8, To: SquareF8}
+
+	case SquareC8:
+		return Move{From: SquareA8, To: SquareD8}
+	}
+
+	return Move{}
 }
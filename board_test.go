@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoardFEN(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen := range tests {
+		t.Run(fen, func(t *testing.T) {
+			b, err := BoardFromFEN(fen)
+			require.NoError(t, err)
+
+			assert.Equal(t, fen, b.FEN())
+		})
+	}
+}
+
+func TestBoardFENMakeMove(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			var walk func(depth int)
+
+			walk = func(depth int) {
+				if depth == 0 {
+					return
+				}
+
+				for _, move := range GenerateMoves(game.Board(), MoveGenerationOptions{}) {
+					game.MakeMove(move)
+
+					b, err := BoardFromFEN(game.FEN())
+					require.NoError(t, err, "fen after %s", move)
+
+					// the last move is not part of the fen
+					b.Moves.Last = game.Board().Moves.Last
+
+					require.Equal(t, *game.Board(), b, "board after %s: %s", move, game.FEN())
+
+					walk(depth - 1)
+
+					game.UnmakeMove()
+				}
+			}
+
+			walk(2)
+		})
+	}
+}
+
+func TestBoardFromFENInvalid(t *testing.T) {
+	tests := map[string]string{
+		"short rank":           "rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"long rank":            "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"too many files":       "rnbqkbnrp/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"missing rank":         "rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"empty":                "",
+		"no kings":             "8/8/8/8/8/8/8/8 w - - 0 1",
+		"two white kings":      "4k3/8/8/8/8/8/8/3KK3 w - - 0 1",
+		"not to move in check": "4k3/8/8/8/8/8/8/4R1K1 w - - 0 1",
+		"pawn on back rank":    "4k2P/8/8/8/8/8/8/4K3 w - - 0 1",
+		"castling no rook":     "4k3/8/8/8/8/8/8/4K3 w K - 0 1",
+		"castling no king":     "r3k2r/8/8/8/8/8/8/R2K3R w Q - 0 1",
+		"en passant rank":      "4k3/8/8/8/4P3/8/8/4K3 b - e4 0 1",
+		"en passant no pawn":   "4k3/8/8/8/8/8/8/4K3 b - e3 0 1",
+		"invalid piece":        "4k3/8/8/8/8/8/8/4X3 w - - 0 1",
+		"negative half moves":  "4k3/8/8/8/8/8/8/4K3 w - - -1 1",
+		"zero full moves":      "4k3/8/8/8/8/8/8/4K3 w - - 0 0",
+	}
+
+	for name, fen := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := BoardFromFEN(fen)
+			assert.ErrorIs(t, err, ErrInvalidFEN)
+		})
+	}
+
+	for _, fen := range []string{tests["pawn on back rank"], "4k3/8/8/8/8/8/8/p3K3 b - - 0 1"} {
+		_, err := BoardFromFENOptions(fen, FENOptions{Lenient: true})
+		assert.ErrorIs(t, err, ErrInvalidFEN, "lenient %s", fen)
+	}
+}
+
+func TestBoardFromFENLenient(t *testing.T) {
+	tests := map[string]string{
+		"not to move in check": "4k3/8/8/8/8/8/8/4R1K1 w - - 0 1",
+		"castling no rook":     "4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+		"en passant rank":      "4k3/8/8/8/4P3/8/8/4K3 b - - 0 1",
+		"missing counters":     "4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+	}
+
+	fens := map[string]string{
+		"castling no rook": "4k3/8/8/8/8/8/8/4K3 w K - 0 1",
+		"en passant rank":  "4k3/8/8/8/4P3/8/8/4K3 b - e4 0 1",
+		"missing counters": "4k3/8/8/8/8/8/8/4K3 w - -",
+	}
+
+	for name, expected := range tests {
+		t.Run(name, func(t *testing.T) {
+			fen, ok := fens[name]
+			if !ok {
+				fen = expected
+			}
+
+			b, err := BoardFromFENOptions(fen, FENOptions{Lenient: true})
+			require.NoError(t, err)
+
+			assert.Equal(t, expected, b.FEN())
+		})
+	}
+}
+
+func FuzzBoardFromFEN(f *testing.F) {
+	tests := loadPerftPositions(f)
+
+	for fen := range tests {
+		f.Add(fen, false)
+		f.Add(fen, true)
+	}
+
+	f.Add("8/8/8/8/8/8/8/8 w - - 0 1", false)
+	f.Add("rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true)
+	f.Add("4k3/8/8/8/8/8/8/p3K3 b - - 0 1", true)
+
+	f.Fuzz(func(t *testing.T, fen string, lenient bool) {
+		b, err := BoardFromFENOptions(fen, FENOptions{Lenient: lenient})
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidFEN)
+			return
+		}
+
+		again, err := BoardFromFENOptions(b.FEN(), FENOptions{Lenient: lenient})
+		require.NoError(t, err)
+		require.Equal(t, b, again)
+
+		for _, move := range GenerateMoves(&b, MoveGenerationOptions{}) {
+			undo := b.Make(move)
+			GenerateMoves(&b, MoveGenerationOptions{})
+			b.Unmake(move, undo)
+		}
+
+		require.Equal(t, again, b)
+	})
+}
+
+func TestBoardMakeMoveHalfMoveClock(t *testing.T) {
+	b, err := BoardFromFEN("4k3/8/8/3p4/8/8/4P3/R3K3 w - - 7 40")
+	require.NoError(t, err)
+
+	tests := []struct {
+		move Move
+		half int
+	}{
+		{NewMove(SquareA1, SquareA2), 8},
+		{NewMove(SquareE8, SquareD7), 9},
+		// pawn moves and captures reset the clock to zero, not one
+		{NewMove(SquareE2, SquareE4, MoveFlagDoublePawnPush), 0},
+		{NewMove(SquareD5, SquareE4, MoveFlagCapture), 0},
+		{NewMove(SquareA2, SquareA7), 1},
+	}
+
+	for _, test := range tests {
+		b = b.MakeMove(test.move)
+
+		assert.Equal(t, test.half, b.Moves.Half, test.move.String())
+	}
+}
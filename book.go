@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"unsafe"
+)
+
+// OpeningBookFilter decides which games, and how much of each, go into a book.
+type OpeningBookFilter struct {
+	// MinElo skips games where either player is rated lower, or unrated.
+	MinElo int
+	// Results lists the results of games to include, all when empty.
+	Results []string
+	// Plies limits how many moves of each game are read, all when zero.
+	Plies int
+}
+
+type openingBookStats struct {
+	Games int32
+	Won   int32
+	Lost  int32
+}
+
+type OpeningBookBuilder struct {
+	Filter  OpeningBookFilter
+	Games   int
+	Skipped int
+
+	// positions holds the statistics of every move played in a position,
+	// keyed by PolyglotKey and the move in polyglot's encoding. Won and lost
+	// are from the point of view of the side making the move.
+	positions map[uint64]map[uint16]*openingBookStats
+}
+
+func NewOpeningBookBuilder(filter OpeningBookFilter) *OpeningBookBuilder {
+	return &OpeningBookBuilder{
+		Filter:    filter,
+		positions: make(map[uint64]map[uint16]*openingBookStats),
+	}
+}
+
+// Add counts the moves of a game in the book, reporting whether the filter
+// let it through.
+func (bb *OpeningBookBuilder) Add(game *Game) bool {
+	if !bb.accept(game) {
+		bb.Skipped++
+		return false
+	}
+
+	bb.Games++
+
+	replay := game.Start()
+
+	for ply, uci := range game.Moves() {
+		if bb.Filter.Plies > 0 && ply >= bb.Filter.Plies {
+			break
+		}
+
+		move, err := ParseUCIMove(replay.Board(), uci)
+		if err != nil {
+			break
+		}
+
+		key := PolyglotKey(replay.Board())
+
+		if bb.positions[key] == nil {
+			bb.positions[key] = make(map[uint16]*openingBookStats)
+		}
+
+		stats := bb.positions[key][PolyglotMove(move)]
+		if stats == nil {
+			stats = &openingBookStats{}
+			bb.positions[key][PolyglotMove(move)] = stats
+		}
+
+		stats.Games++
+
+		switch {
+		case game.Result == PGNResultWhite && replay.Board().Player == White,
+			game.Result == PGNResultBlack && replay.Board().Player == Black:
+			stats.Won++
+
+		case game.Result == PGNResultWhite, game.Result == PGNResultBlack:
+			stats.Lost++
+		}
+
+		replay.MakeMove(move)
+	}
+
+	return true
+}
+
+func (bb *OpeningBookBuilder) accept(game *Game) bool {
+	if len(bb.Filter.Results) > 0 && !slices.Contains(bb.Filter.Results, game.Result) {
+		return false
+	}
+
+	if bb.Filter.MinElo > 0 {
+		for _, tag := range []string{"WhiteElo", "BlackElo"} {
+			value, _ := game.Tag(tag)
+
+			if elo, err := strconv.Atoi(value); err != nil || elo < bb.Filter.MinElo {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (bb *OpeningBookBuilder) Positions() int {
+	return len(bb.positions)
+}
+
+// moves returns the moves played at least minGames times in a position,
+// most played first.
+func (bb *OpeningBookBuilder) moves(key uint64, minGames int) []uint16 {
+	moves := slices.DeleteFunc(slices.Collect(maps.Keys(bb.positions[key])), func(move uint16) bool {
+		return int(bb.positions[key][move].Games) < minGames
+	})
+
+	slices.SortFunc(moves, func(a, b uint16) int {
+		if games := bb.positions[key][b].Games - bb.positions[key][a].Games; games != 0 {
+			return int(games)
+		}
+
+		return int(a) - int(b)
+	})
+
+	return moves
+}
+
+// WritePolyglot writes the book with each move weighted by the points it
+// scored, two for a win and one for a draw.
+func (bb *OpeningBookBuilder) WritePolyglot(w io.Writer, minGames int) error {
+	entries := []PolyglotEntry(nil)
+	points := []int(nil)
+
+	for key := range bb.positions {
+		for _, move := range bb.moves(key, minGames) {
+			stats := bb.positions[key][move]
+
+			entries = append(entries, PolyglotEntry{Key: key, Move: move})
+			points = append(points, int(2*stats.Won+stats.Games-stats.Won-stats.Lost))
+		}
+	}
+
+	// scale the weights down together if any would overflow
+	scale := max(1, (slices.Max(append(points, 0))+0xffff-1)/0xffff)
+
+	for i := range entries {
+		entries[i].Weight = uint16(points[i] / scale)
+	}
+
+	return WritePolyglotBook(w, entries)
+}
+
+// WriteABK writes the book as an ABK tree rooted at the starting position,
+// laid out like Arena's books with each move followed by its replies. A
+// position reached again by transposition is only expanded the first time,
+// IndexOpeningBook finds its moves by position either way.
+func (bb *OpeningBookBuilder) WriteABK(w io.Writer, minGames int, comment string) error {
+	game, err := GameFromFEN(BoardStartPos)
+	if err != nil {
+		return err
+	}
+
+	entries := bb.abkEntries(nil, game, make(map[uint64]bool), minGames)
+
+	if _, err := w.Write(abkHeader(comment)); err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	_, err = w.Write(unsafe.Slice((*byte)(unsafe.Pointer(&entries[0])), len(entries)*int(unsafe.Sizeof(OpeningMove{}))))
+
+	return err
+}
+
+func (bb *OpeningBookBuilder) abkEntries(entries []OpeningMove, game *Game, visited map[uint64]bool, minGames int) []OpeningMove {
+	key := PolyglotKey(game.Board())
+	if visited[key] {
+		return entries
+	}
+
+	visited[key] = true
+
+	moves := bb.moves(key, minGames)
+	previous := -1
+
+	for _, encoded := range moves {
+		move, err := ParseUCIMove(game.Board(), PolyglotEntry{Move: encoded}.UCI(game.Board()))
+		if err != nil {
+			continue
+		}
+
+		stats := bb.positions[key][encoded]
+		i := len(entries)
+
+		if previous >= 0 {
+			entries[previous].sibling = int32(OpeningBookStartPos + i)
+		}
+
+		entries = append(entries, OpeningMove{
+			From:      move.From,
+			To:        move.To,
+			Promotion: abkPromotion(move),
+			// priorities run from 1 to 9 relative to the most played move
+			Priority: int8((9*stats.Games + bb.positions[key][moves[0]].Games - 1) / bb.positions[key][moves[0]].Games),
+			Games:    stats.Games,
+			Won:      stats.Won,
+			Lost:     stats.Lost,
+			next:     -1,
+			sibling:  -1,
+		})
+
+		game.MakeMove(move)
+		entries = bb.abkEntries(entries, game, visited, minGames)
+		game.UnmakeMove()
+
+		if len(entries) > i+1 {
+			entries[i].next = int32(OpeningBookStartPos + i + 1)
+		}
+
+		previous = i
+	}
+
+	return entries
+}
+
+func abkPromotion(move Move) int8 {
+	promotion, ok := move.Promotion()
+	if !ok {
+		return 0
+	}
+
+	return int8(slices.Index([]PieceType{Rook, Knight, Bishop, Queen}, promotion) + 1)
+}
+
+// abkHeader fills the space before OpeningBookStartPos. Only the signature
+// and comment are written, the rest holds Arena's book settings which are
+// left at zero.
+func abkHeader(comment string) []byte {
+	header := make([]byte, OpeningBookStartPos*unsafe.Sizeof(OpeningMove{}))
+
+	// both are length prefixed strings
+	copy(header, "\x03AB2")
+
+	comment = comment[:min(len(comment), 120)]
+	header[0x0c] = byte(len(comment))
+	copy(header[0x0d:], comment)
+
+	return header
+}
+
+// OpeningBookStats summarizes the shape of an ABK tree.
+type OpeningBookStats struct {
+	Bytes     int
+	Entries   int
+	Positions int
+	Leaves    int
+	// Unreachable counts entries in the file that no pointer leads to.
+	Unreachable int
+	// Depths counts the entries at each ply, starting from the root moves.
+	Depths []int
+	// Games is the number of games counted by the root moves.
+	Games int
+}
+
+func StatOpeningBook(book []byte) (OpeningBookStats, error) {
+	stats := OpeningBookStats{Bytes: len(book)}
+	positions := make(map[uint64]bool)
+
+	err := WalkOpeningBook(book, func(game *Game, depth int, opening *OpeningMove) {
+		stats.Entries++
+		positions[PolyglotKey(game.Board())] = true
+
+		if opening.next <= 0 {
+			stats.Leaves++
+		}
+
+		for len(stats.Depths) <= depth {
+			stats.Depths = append(stats.Depths, 0)
+		}
+
+		stats.Depths[depth]++
+
+		if depth == 0 {
+			stats.Games += int(opening.Games)
+		}
+	})
+
+	stats.Positions = len(positions)
+	stats.Unreachable = max(0, len(book)/int(unsafe.Sizeof(OpeningMove{}))-OpeningBookStartPos-stats.Entries)
+
+	return stats, err
+}
+
+type BookRunner struct {
+	Build    BookBuildRunner    `cmd:"" help:"Build an opening book from PGN files"`
+	Show     BookShowRunner     `cmd:"" help:"List the book moves in a position"`
+	Stats    BookStatsRunner    `cmd:"" help:"Summarize the size and depth of a book"`
+	Validate BookValidateRunner `cmd:"" help:"Check every pointer and move in a book"`
+}
+
+// BookSource selects the ABK book a command reads.
+type BookSource struct {
+	File string `help:"ABK book to read instead of the built-in one" type:"existingfile"`
+}
+
+func (s BookSource) load() ([]byte, error) {
+	if s.File == "" {
+		return _OpeningBook, nil
+	}
+
+	book, err := os.ReadFile(s.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read book: %w", err)
+	}
+
+	return book, nil
+}
+
+type BookShowRunner struct {
+	BookSource `embed:""`
+
+	FEN   string   `help:"Position to show" default:"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"`
+	Moves []string `help:"Moves to play from the position first"`
+}
+
+func (r *BookShowRunner) Run() error {
+	book, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	index, err := IndexOpeningBook(book)
+	if err != nil {
+		return err
+	}
+
+	game, err := GameFromFEN(r.FEN)
+	if err != nil {
+		return err
+	}
+
+	for _, move := range r.Moves {
+		if err := game.MakeUCIMove(move); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("fen %s\n\n", game.FEN())
+
+	moves := index[PolyglotKey(game.Board())]
+	if len(moves) == 0 {
+		fmt.Println("no book moves")
+		return nil
+	}
+
+	slices.SortStableFunc(moves, func(a, b OpeningMove) int {
+		return int(b.Games) - int(a.Games)
+	})
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "move\tsan\tgames\twon\tlost\tscore\tpriority")
+
+	for _, opening := range moves {
+		move, err := ParseUCIMove(game.Board(), opening.String())
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%s\t%s\t%d\t%d\t%d\t%.1f%%\t%d\n", opening.String(), FormatSAN(game.Board(), move), opening.Games, opening.Won, opening.Lost, 100*opening.Score(), opening.Priority)
+	}
+
+	return out.Flush()
+}
+
+type BookStatsRunner struct {
+	BookSource `embed:""`
+}
+
+func (r *BookStatsRunner) Run() error {
+	book, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	stats, err := StatOpeningBook(book)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(out, "size\t%d bytes\n", stats.Bytes)
+	fmt.Fprintf(out, "entries\t%d\n", stats.Entries)
+	fmt.Fprintf(out, "positions\t%d\n", stats.Positions)
+	fmt.Fprintf(out, "leaves\t%d\n", stats.Leaves)
+	fmt.Fprintf(out, "unreachable\t%d\n", stats.Unreachable)
+	fmt.Fprintf(out, "games\t%d\n", stats.Games)
+	fmt.Fprintf(out, "max depth\t%d plies\n", len(stats.Depths))
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "ply\tentries")
+
+	for depth, entries := range stats.Depths {
+		fmt.Fprintf(out, "%d\t%d\n", depth+1, entries)
+	}
+
+	return out.Flush()
+}
+
+type BookValidateRunner struct {
+	BookSource `embed:""`
+}
+
+func (r *BookValidateRunner) Run() error {
+	book, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	stats, err := StatOpeningBook(book)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ok, %d entries\n", stats.Entries)
+
+	return nil
+}
+
+type BookBuildRunner struct {
+	Files    []string `arg:"" help:"PGN files to read, - for stdin"`
+	Output   string   `short:"o" required:"" help:"File to write the book to"`
+	Format   string   `help:"Book format, auto picks from the output extension" enum:"auto,abk,polyglot" default:"auto"`
+	MinElo   int      `help:"Skip games where either player is rated below this"`
+	Results  []string `help:"Results of games to include" default:"1-0,0-1,1/2-1/2"`
+	Plies    int      `help:"Number of plies to read from each game, 0 for all" default:"20"`
+	MinGames int      `help:"Leave out moves played in fewer games" default:"1"`
+}
+
+func (r *BookBuildRunner) Run(ctx context.Context) error {
+	format := r.Format
+
+	if format == "auto" {
+		switch filepath.Ext(r.Output) {
+		case ".abk":
+			format = "abk"
+
+		case ".bin":
+			format = "polyglot"
+
+		default:
+			return fmt.Errorf("cannot tell book format from %s, use --format", r.Output)
+		}
+	}
+
+	builder := NewOpeningBookBuilder(OpeningBookFilter{
+		MinElo:  r.MinElo,
+		Results: r.Results,
+		Plies:   r.Plies,
+	})
+
+	invalid := 0
+
+	for _, path := range r.Files {
+		n, err := r.read(ctx, builder, path)
+		if err != nil {
+			return err
+		}
+
+		invalid += n
+	}
+
+	output, err := os.Create(r.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create book: %w", err)
+	}
+
+	defer output.Close()
+
+	if format == "abk" {
+		err = builder.WriteABK(output, r.MinGames, "built by chester")
+	} else {
+		err = builder.WritePolyglot(output, r.MinGames)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write book: %w", err)
+	}
+
+	fmt.Printf("games %d, skipped %d, invalid %d, positions %d\n", builder.Games, builder.Skipped, invalid, builder.Positions())
+
+	return output.Close()
+}
+
+// read adds the games in a PGN file to the builder, returning how many were
+// skipped because they couldn't be read.
+func (r *BookBuildRunner) read(ctx context.Context, builder *OpeningBookBuilder, path string) (int, error) {
+	input := io.Reader(os.Stdin)
+
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open pgn file: %w", err)
+		}
+
+		defer file.Close()
+
+		input = file
+	}
+
+	pgn := NewPGNReader(input)
+	invalid := 0
+
+	for ctx.Err() == nil {
+		game, err := pgn.Next()
+		if errors.Is(err, io.EOF) {
+			return invalid, nil
+		} else if errors.Is(err, ErrInvalidPGN) {
+			slog.Warn("skipping game", "file", path, "error", err)
+
+			invalid++
+
+			if err := pgn.Skip(); err != nil {
+				return invalid, fmt.Errorf("%s: %w", path, err)
+			}
+
+			continue
+		} else if err != nil {
+			return invalid, fmt.Errorf("%s: %w", path, err)
+		}
+
+		builder.Add(game)
+	}
+
+	return invalid, ctx.Err()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBookPGN = `
+[WhiteElo "2500"]
+[BlackElo "2400"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 1-0
+
+[WhiteElo "2600"]
+[BlackElo "2600"]
+[Result "0-1"]
+
+1. e4 c5 2. Nf3 0-1
+
+[WhiteElo "2450"]
+[BlackElo "2450"]
+[Result "1/2-1/2"]
+
+1. Nf3 Nc6 2. e4 e5 1/2-1/2
+
+[WhiteElo "2450"]
+[BlackElo "2450"]
+[Result "*"]
+
+1. d4 d5 *
+
+[WhiteElo "1200"]
+[BlackElo "2450"]
+[Result "1-0"]
+
+1. c4 e5 1-0
+
+[WhiteElo "2700"]
+[BlackElo "2700"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. O-O 1-0
+`
+
+func buildTestBook(t *testing.T, filter OpeningBookFilter) *OpeningBookBuilder {
+	games, err := ReadPGN(strings.NewReader(testBookPGN))
+	require.NoError(t, err)
+
+	builder := NewOpeningBookBuilder(filter)
+
+	for _, game := range games {
+		builder.Add(game)
+	}
+
+	return builder
+}
+
+func testBookBoard(t *testing.T, moves ...string) *Board {
+	game, err := GameFromFEN(BoardStartPos)
+	require.NoError(t, err)
+
+	for _, move := range moves {
+		require.NoError(t, game.MakeUCIMove(move))
+	}
+
+	return game.Board()
+}
+
+func TestOpeningBookBuilderFilter(t *testing.T) {
+	builder := buildTestBook(t, OpeningBookFilter{
+		MinElo:  2000,
+		Results: []string{PGNResultWhite, PGNResultBlack, PGNResultDraw},
+	})
+
+	assert.Equal(t, 4, builder.Games)
+	assert.Equal(t, 2, builder.Skipped)
+
+	builder = buildTestBook(t, OpeningBookFilter{})
+
+	assert.Equal(t, 6, builder.Games)
+	assert.Zero(t, builder.Skipped)
+}
+
+func TestOpeningBookBuilderABK(t *testing.T) {
+	builder := buildTestBook(t, OpeningBookFilter{
+		MinElo:  2000,
+		Results: []string{PGNResultWhite, PGNResultBlack, PGNResultDraw},
+	})
+
+	buf := bytes.Buffer{}
+	require.NoError(t, builder.WriteABK(&buf, 1, "test"))
+
+	assert.Equal(t, "\x03AB2", buf.String()[:4])
+
+	index, err := IndexOpeningBook(buf.Bytes())
+	require.NoError(t, err)
+
+	moves := func(board *Board) map[string]OpeningMove {
+		found := map[string]OpeningMove{}
+
+		for _, opening := range index[PolyglotKey(board)] {
+			found[opening.String()] = opening
+		}
+
+		return found
+	}
+
+	start := moves(testBookBoard(t))
+	require.Len(t, start, 2)
+	// each move is followed by its replies, then its sibling's subtree
+	assert.Equal(t, OpeningMove{From: SquareE2, To: SquareE4, Priority: 9, Games: 3, Won: 2, Lost: 1, next: 901, sibling: 910}, start["e2e4"])
+	assert.Equal(t, OpeningMove{From: SquareG1, To: SquareF3, Priority: 3, Games: 1, next: 911, sibling: -1}, start["g1f3"])
+
+	// reached by both move orders, only expanded once in the tree
+	transposed := moves(testBookBoard(t, "g1f3", "b8c6", "e2e4", "e7e5"))
+	assert.Len(t, transposed, 2)
+	assert.Contains(t, transposed, "f1b5")
+	assert.Contains(t, transposed, "f1c4")
+
+	castle := moves(testBookBoard(t, "e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "f8c5"))
+	assert.Contains(t, castle, "e1g1")
+
+	assert.Empty(t, moves(testBookBoard(t, "d2d4")))
+}
+
+func TestOpeningBookBuilderPolyglot(t *testing.T) {
+	builder := buildTestBook(t, OpeningBookFilter{Plies: 6})
+
+	buf := bytes.Buffer{}
+	require.NoError(t, builder.WritePolyglot(&buf, 1))
+
+	book, err := ReadPolyglotBook(&buf)
+	require.NoError(t, err)
+
+	moves := func(board *Board) map[string]uint16 {
+		found := map[string]uint16{}
+
+		for _, entry := range book.Entries(board) {
+			found[entry.UCI(board)] = entry.Weight
+		}
+
+		return found
+	}
+
+	// two points a win, one a draw, for the side making the move
+	assert.Equal(t, map[string]uint16{"e2e4": 4, "g1f3": 1, "d2d4": 1, "c2c4": 2}, moves(testBookBoard(t)))
+	assert.Equal(t, map[string]uint16{"e7e5": 0, "c7c5": 2}, moves(testBookBoard(t, "e2e4")))
+
+	// the game castles on its seventh ply
+	assert.Empty(t, moves(testBookBoard(t, "e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "f8c5")))
+
+	builder = buildTestBook(t, OpeningBookFilter{})
+	buf.Reset()
+	require.NoError(t, builder.WritePolyglot(&buf, 1))
+
+	book, err = ReadPolyglotBook(&buf)
+	require.NoError(t, err)
+
+	assert.Contains(t, moves(testBookBoard(t, "e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "f8c5")), "e1g1")
+
+	buf.Reset()
+	require.NoError(t, builder.WritePolyglot(&buf, 2))
+
+	book, err = ReadPolyglotBook(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]uint16{"e2e4": 4}, moves(testBookBoard(t)))
+}
+
+func TestBookBuildRunnerRead(t *testing.T) {
+	pgn := `
+[Result "1-0"]
+
+1. e4 e5 2. Qxe5 1-0
+
+[Result "1-0"]
+
+1. e4 e5 1-0
+
+[FEN "8/8/8/8/8/8/8/8 w - - 0 1"]
+[Result "*"]
+
+*
+
+[Result "0-1"]
+
+1. d4 d5 0-1
+`
+
+	path := filepath.Join(t.TempDir(), "games.pgn")
+	require.NoError(t, os.WriteFile(path, []byte(pgn), 0o644))
+
+	builder := NewOpeningBookBuilder(OpeningBookFilter{})
+
+	invalid, err := (&BookBuildRunner{}).read(context.Background(), builder, path)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, invalid)
+	assert.Equal(t, 2, builder.Games)
+}
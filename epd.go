@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrInvalidEPD = fmt.Errorf("invalid epd")
+
+type EPD struct {
+	Board      Board
+	Operations map[string][]string
+}
+
+func ParseEPD(line string) (EPD, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return EPD{}, fmt.Errorf("%w: expected at least 4 fields, got %d", ErrInvalidEPD, len(fields))
+	}
+
+	epd := EPD{}
+
+	// skip the four position fields and keep the operations as written so
+	// quoted operands keep their spacing
+	rest := strings.TrimSpace(line)
+
+	for range 4 {
+		rest = strings.TrimSpace(rest[len(strings.Fields(rest)[0]):])
+	}
+
+	ops, err := parseEPDOperations(rest)
+	if err != nil {
+		return EPD{}, err
+	}
+
+	fen := strings.Join(fields[:4], " ")
+
+	half, full := "0", "1"
+
+	if op, ok := ops["hmvc"]; ok && len(op) == 1 {
+		half = op[0]
+	}
+
+	if op, ok := ops["fmvn"]; ok && len(op) == 1 {
+		full = op[0]
+	}
+
+	if epd.Board, err = BoardFromFEN(fen + " " + half + " " + full); err != nil {
+		return EPD{}, fmt.Errorf("%w: %w", ErrInvalidEPD, err)
+	}
+
+	epd.Operations = ops
+
+	return epd, nil
+}
+
+func parseEPDOperations(s string) (map[string][]string, error) {
+	ops := make(map[string][]string)
+
+	operands := []string(nil)
+	operand := strings.Builder{}
+	quoted := false
+
+	flush := func() {
+		if operand.Len() > 0 {
+			operands = append(operands, operand.String())
+			operand.Reset()
+		}
+	}
+
+	for _, c := range s {
+		switch {
+		case c == '"':
+			if quoted {
+				operands = append(operands, operand.String())
+				operand.Reset()
+			}
+
+			quoted = !quoted
+
+		case quoted:
+			operand.WriteRune(c)
+
+		case c == ';':
+			flush()
+
+			if len(operands) > 0 {
+				ops[operands[0]] = operands[1:]
+			}
+
+			operands = nil
+
+		case c == ' ' || c == '\t':
+			flush()
+
+		default:
+			operand.WriteRune(c)
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("%w: unterminated string: %s", ErrInvalidEPD, s)
+	}
+
+	flush()
+
+	if len(operands) > 0 {
+		return nil, fmt.Errorf("%w: unterminated operation: %s", ErrInvalidEPD, strings.Join(operands, " "))
+	}
+
+	return ops, nil
+}
+
+// Moves parses the SAN operands of an operation such as bm or am.
+func (epd EPD) Moves(opcode string) ([]Move, error) {
+	moves := []Move(nil)
+
+	for _, san := range epd.Operations[opcode] {
+		move, err := ParseSAN(&epd.Board, san)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidEPD, opcode, err)
+		}
+
+		moves = append(moves, move)
+	}
+
+	return moves, nil
+}
+
+func (epd EPD) ID() string {
+	if id := epd.Operations["id"]; len(id) > 0 {
+		return strings.Join(id, " ")
+	}
+
+	return epd.Board.FEN()
+}
+
+type EPDRunner struct {
+	File     string        `arg:"" help:"EPD file to run, - for stdin"`
+	MoveTime time.Duration `help:"Time to search each position, defaults to 1s without another limit"`
+	Depth    int           `help:"Depth to search each position to"`
+	Nodes    int           `help:"Nodes to search in each position"`
+	Hash     int           `help:"Size of the transposition table in megabytes" default:"128"`
+	Threads  int           `help:"Number of threads to search with" default:"1"`
+	JSON     string        `help:"Write a JSON summary to a file, - for stdout with the table on stderr"`
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type EPDSummary struct {
+	File      string      `json:"file"`
+	Total     int         `json:"total"`
+	Solved    int         `json:"solved"`
+	Failed    int         `json:"failed"`
+	Skipped   int         `json:"skipped"`
+	Nodes     int         `json:"nodes"`
+	TimeMS    int64       `json:"time_ms"`
+	Positions []EPDResult `json:"positions"`
+}
+
+type EPDResult struct {
+	ID     string   `json:"id"`
+	FEN    string   `json:"fen"`
+	Best   []string `json:"bm,omitempty"`
+	Avoid  []string `json:"am,omitempty"`
+	Move   string   `json:"move"`
+	Solved bool     `json:"solved"`
+	Depth  int      `json:"depth"`
+	Nodes  int      `json:"nodes"`
+	TimeMS int64    `json:"time_ms"`
+	// SolvedMS is how long the search took to settle on a correct move and
+	// keep it until the end, only set for solved positions.
+	SolvedMS int64 `json:"solved_ms,omitempty"`
+}
+
+func (r *EPDRunner) Run(ctx context.Context) error {
+	r.stdin = os.Stdin
+	r.stdout = os.Stdout
+	r.stderr = os.Stderr
+
+	return r.run(ctx)
+}
+
+func (r *EPDRunner) run(ctx context.Context) error {
+	if r.MoveTime == 0 && r.Depth == 0 && r.Nodes == 0 {
+		r.MoveTime = time.Second
+	}
+
+	input := r.stdin
+
+	if r.File != "-" {
+		file, err := os.Open(r.File)
+		if err != nil {
+			return fmt.Errorf("failed to open epd file: %w", err)
+		}
+
+		defer file.Close()
+
+		input = file
+	}
+
+	summary := EPDSummary{File: r.File}
+	tt := NewTranspositionTable(uintptr(r.Hash) * 1024 * 1024)
+
+	// keep stdout parseable when the summary is written there
+	report := r.stdout
+	if r.JSON == "-" {
+		report = r.stderr
+	}
+
+	out := tabwriter.NewWriter(report, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "id\tresult\tmove\texpected\tdepth\tnodes\ttime\tsolved at")
+
+	scanner := bufio.NewScanner(input)
+
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// one bad line shouldn't cost the rest of a large suite
+		epd, err := ParseEPD(text)
+		if err != nil {
+			r.skip(out, &summary, line, err)
+			continue
+		}
+
+		result, err := r.solve(ctx, tt, epd)
+		if err != nil {
+			r.skip(out, &summary, line, err)
+			continue
+		}
+
+		summary.Total++
+		summary.Nodes += result.Nodes
+		summary.TimeMS += result.TimeMS
+		summary.Positions = append(summary.Positions, result)
+
+		status := "failed"
+		if result.Solved {
+			status = "solved"
+			summary.Solved++
+		} else {
+			summary.Failed++
+		}
+
+		expected := "bm " + strings.Join(result.Best, " ")
+		if len(result.Best) == 0 {
+			expected = "am " + strings.Join(result.Avoid, " ")
+		}
+
+		solved := "-"
+		if result.Solved {
+			solved = fmt.Sprintf("%dms", result.SolvedMS)
+		}
+
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%d\t%d\t%dms\t%s\n", result.ID, status, result.Move, expected, result.Depth, result.Nodes, result.TimeMS, solved)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read epd file: %w", err)
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(report, "\nsolved %d/%d, failed %d, skipped %d, nodes %d, time %dms\n", summary.Solved, summary.Total, summary.Failed, summary.Skipped, summary.Nodes, summary.TimeMS)
+
+	if r.JSON != "" {
+		return r.write(summary)
+	}
+
+	return nil
+}
+
+func (r *EPDRunner) skip(out io.Writer, summary *EPDSummary, line int, err error) {
+	slog.Warn("skipping epd line", "line", line, "error", err)
+
+	summary.Skipped++
+
+	fmt.Fprintf(out, "line %d\tskipped\t-\t-\t-\t-\t-\t-\n", line)
+}
+
+func (r *EPDRunner) solve(ctx context.Context, tt *TranspositionTable, epd EPD) (EPDResult, error) {
+	best, err := epd.Moves("bm")
+	if err != nil {
+		return EPDResult{}, err
+	}
+
+	avoid, err := epd.Moves("am")
+	if err != nil {
+		return EPDResult{}, err
+	}
+
+	if len(best) == 0 && len(avoid) == 0 {
+		return EPDResult{}, fmt.Errorf("%w: %s: missing bm or am", ErrInvalidEPD, epd.ID())
+	}
+
+	correct := func(move Move) bool {
+		if len(best) > 0 && !slices.Contains(best, move) {
+			return false
+		}
+
+		return !slices.Contains(avoid, move)
+	}
+
+	result := EPDResult{
+		ID:    epd.ID(),
+		FEN:   epd.Board.FEN(),
+		Best:  epd.Operations["bm"],
+		Avoid: epd.Operations["am"],
+	}
+
+	cancel := context.CancelFunc(nil)
+
+	if r.MoveTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.MoveTime)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	defer cancel()
+
+	tt.Clear()
+
+	solved := time.Duration(-1)
+
+	sctx := &SearchContext{
+		Context:    ctx,
+		Game:       GameFromBoard(epd.Board),
+		TT:         tt,
+		Threads:    r.Threads,
+		Heuristics: &SearchHeuristics{},
+		Limits: SearchLimits{
+			Depth: r.Depth,
+			Nodes: r.Nodes,
+		},
+		Options: SearchOptions{
+			PVS:                true,
+			NullMovePruning:    true,
+			LateMoveReductions: true,
+		},
+		OnIteration: func(sctx *SearchContext) {
+			result.Depth = sctx.Depth
+
+			if !correct(sctx.Best) {
+				solved = -1
+			} else if solved < 0 {
+				solved = time.Since(sctx.Start)
+			}
+		},
+	}
+
+	slog.Debug("solving position", "id", result.ID, "fen", result.FEN)
+
+	Search(sctx)
+
+	result.Move = FormatSAN(&epd.Board, sctx.Best)
+	result.Solved = correct(sctx.Best) && solved >= 0
+	result.Nodes = sctx.Nodes()
+	result.TimeMS = time.Since(sctx.Start).Milliseconds()
+
+	if result.Solved {
+		result.SolvedMS = solved.Milliseconds()
+	}
+
+	return result, nil
+}
+
+func (r *EPDRunner) write(summary EPDSummary) error {
+	output := r.stdout
+
+	if r.JSON != "-" {
+		file, err := os.Create(r.JSON)
+		if err != nil {
+			return fmt.Errorf("failed to create json summary: %w", err)
+		}
+
+		defer file.Close()
+
+		output = file
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(summary); err != nil {
+		return fmt.Errorf("failed to encode json summary: %w", err)
+	}
+
+	return nil
+}
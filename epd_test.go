@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEPD(t *testing.T) {
+	epd, err := ParseEPD(`r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5 Bc4; am Ng5; id "Italian or Spanish"; hmvc 2; fmvn 3;`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", epd.Board.FEN())
+	assert.Equal(t, "Italian or Spanish", epd.ID())
+	assert.Equal(t, []string{"Bb5", "Bc4"}, epd.Operations["bm"])
+
+	best, err := epd.Moves("bm")
+	require.NoError(t, err)
+	assert.Equal(t, "f1b5", best[0].String())
+	assert.Equal(t, "f1c4", best[1].String())
+
+	avoid, err := epd.Moves("am")
+	require.NoError(t, err)
+	assert.Equal(t, "f3g5", avoid[0].String())
+}
+
+func TestParseEPDInvalid(t *testing.T) {
+	tests := map[string]string{
+		"short":                  "8/8/8/8 w -",
+		"invalid position":       "8/8/8/8/8/8/8/8 w - - bm e4;",
+		"unterminated string":    `4k3/8/8/8/8/8/4P3/4K3 w - - id "abc;`,
+		"unterminated operation": "4k3/8/8/8/8/8/4P3/4K3 w - - bm e4",
+	}
+
+	for name, line := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseEPD(line)
+			assert.ErrorIs(t, err, ErrInvalidEPD)
+		})
+	}
+
+	epd, err := ParseEPD("4k3/8/8/8/8/8/4P3/4K3 w - - bm e5;")
+	require.NoError(t, err)
+
+	_, err = epd.Moves("bm")
+	assert.ErrorIs(t, err, ErrInvalidEPD)
+	assert.ErrorIs(t, err, ErrInvalidMove)
+}
+
+func TestEPDRunnerJSON(t *testing.T) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+
+	r := EPDRunner{
+		File:    "-",
+		Depth:   2,
+		Hash:    1,
+		Threads: 1,
+		JSON:    "-",
+		stdin:   strings.NewReader(`6k1/5ppp/8/8/8/8/8/R5K1 w - - bm Ra8#; id "back rank";` + "\n"),
+		stdout:  &stdout,
+		stderr:  &stderr,
+	}
+
+	require.NoError(t, r.run(context.Background()))
+
+	// the table goes to stderr so stdout is only the summary
+	summary := EPDSummary{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &summary))
+
+	assert.Equal(t, 1, summary.Solved)
+	assert.Equal(t, "Ra8#", summary.Positions[0].Move)
+	assert.Contains(t, stderr.String(), "back rank")
+	assert.Contains(t, stderr.String(), "solved 1/1")
+}
+
+func TestEPDRunnerSkip(t *testing.T) {
+	stdout := bytes.Buffer{}
+
+	input := strings.Join([]string{
+		`6k1/5ppp/8/8/8/8/8/R5K1 w - - bm Ra8#; id "back rank";`,
+		`6k1/5ppp/8/8/8/8/8/R5K1 w - bm Ra8#;`,
+		`6k1/5ppp/8/8/8/8/8/R5K1 w - - bm Rb8#; id "illegal";`,
+		`6k1/5ppp/8/8/8/8/8/R5K1 w - - id "no best move";`,
+		`k7/8/2K5/8/8/8/8/7R w - - bm Rh8; id "corner";`,
+	}, "\n")
+
+	r := EPDRunner{
+		File:    "-",
+		Depth:   2,
+		Hash:    1,
+		Threads: 1,
+		JSON:    "-",
+		stdin:   strings.NewReader(input),
+		stdout:  &stdout,
+		stderr:  &bytes.Buffer{},
+	}
+
+	require.NoError(t, r.run(context.Background()))
+
+	summary := EPDSummary{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &summary))
+
+	assert.Equal(t, 2, summary.Total)
+	assert.Equal(t, 3, summary.Skipped)
+	require.Len(t, summary.Positions, 2)
+	assert.Equal(t, "back rank", summary.Positions[0].ID)
+	assert.Equal(t, "corner", summary.Positions[1].ID)
+}
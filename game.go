@@ -1,112 +1,159 @@
 package main
 
-import "iter"
+import (
+	"slices"
+)
 
 type Game struct {
-	boards []Board
-	moves  []string
+	Tags    []PGNTag
+	Result  string
+	Comment string
+
+	board       Board
+	history     []GameHistory
+	moves       []string
+	annotations []PGNAnnotation
+}
+
+type GameHistory struct {
+	Move Move
+	Undo BoardUndo
 }
 
 func GameFromFEN(fen string) (*Game, error) {
-	board, err := BoardFromFEN(fen)
+	return GameFromFENOptions(fen, FENOptions{})
+}
+
+func GameFromFENOptions(fen string, opts FENOptions) (*Game, error) {
+	board, err := BoardFromFENOptions(fen, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	return GameFromBoard(board), nil
+}
+
+func GameFromBoard(board Board) *Game {
+	return &Game{
+		board: board,
+	}
+}
+
+func (g *Game) Clone() *Game {
 	return &Game{
-		boards: []Board{
-			board,
-		},
-	}, nil
+		Tags:        slices.Clone(g.Tags),
+		Result:      g.Result,
+		Comment:     g.Comment,
+		board:       g.board,
+		history:     slices.Clone(g.history),
+		moves:       slices.Clone(g.moves),
+		annotations: slices.Clone(g.annotations),
+	}
 }
 
 func (g *Game) Board() *Board {
-	return &g.boards[len(g.boards)-1]
+	return &g.board
 }
 
-func (g *Game) Boards() iter.Seq[*Board] {
-	return func(yield func(*Board) bool) {
-		for i := 0; i < len(g.boards); i++ {
-			if !yield(&g.boards[i]) {
-				break
-			}
+func (g *Game) FEN() string {
+	return g.board.FEN()
+}
+
+func (g *Game) IsRepetition() bool {
+	// only positions since the last irreversible move can repeat, and only
+	// those with the same player to move
+	for i := len(g.history) - 2; i >= 0 && i >= len(g.history)-g.board.Moves.Half; i -= 2 {
+		if g.history[i].Undo.Zobrist == g.board.Zobrist {
+			return true
 		}
 	}
+
+	return false
 }
 
 func (g *Game) Moves() []string {
 	return g.moves
 }
 
-func (g *Game) MakeMove(move Move) {
-	g.boards = append(g.boards, g.Board().MakeMove(move))
+func (g *Game) Annotations() []PGNAnnotation {
+	return g.annotations
 }
 
-func (g *Game) MakeUCIMove(uci string) bool {
-	if len(uci) < 4 || len(uci) > 5 {
-		return false
+func (g *Game) Tag(name string) (string, bool) {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
 	}
 
-	from, ok := SquareFromString(uci[:2])
-	if !ok {
-		return false
-	}
+	return "", false
+}
 
-	to, ok := SquareFromString(uci[2:4])
-	if !ok {
-		return false
+func (g *Game) SetTag(name, value string) {
+	for i, tag := range g.Tags {
+		if tag.Name == name {
+			g.Tags[i].Value = value
+			return
+		}
 	}
 
-	move := NewMove(from, to)
+	g.Tags = append(g.Tags, PGNTag{Name: name, Value: value})
+}
 
-	if len(uci) == 5 {
-		switch uci[4] {
-		case 'q':
-			move.Flags |= MoveFlagPromoteToQueen
+// Start returns a copy of the game rewound to its initial position.
+func (g *Game) Start() *Game {
+	start := g.Clone()
 
-		case 'r':
-			move.Flags |= MoveFlagPromoteToRook
+	for len(start.history) > 0 {
+		start.UnmakeMove()
+	}
 
-		case 'b':
-			move.Flags |= MoveFlagPromoteToBishop
+	start.moves = nil
+	start.annotations = nil
 
-		case 'n':
-			move.Flags |= MoveFlagPromoteToKnight
+	return start
+}
 
-		default:
-			return false
-		}
-	}
+func (g *Game) MakeMove(move Move) {
+	g.history = append(g.history, GameHistory{
+		Move: move,
+		Undo: g.board.Make(move),
+	})
+}
 
-	b := g.Board()
-	p := b.Squares[move.From]
+func (g *Game) MakeNullMove() {
+	g.history = append(g.history, GameHistory{
+		Undo: g.board.MakeNull(),
+	})
+}
 
-	if b.EnPassant != 0 && p.Type() == Pawn && move.To == b.EnPassant {
-		move.Flags |= MoveFlagCapture
-		move.Flags |= MoveFlagCaptureEnPassant
-	} else if p.Type() == Pawn && abs(move.From.Rank()-move.To.Rank()) == 2 {
-		move.Flags |= MoveFlagDoublePawnPush
+func (g *Game) MakeUCIMove(uci string) error {
+	move, err := ParseUCIMove(g.Board(), uci)
+	if err != nil {
+		return err
 	}
 
-	if b.Squares[move.To] != EmptySquare {
-		move.Flags |= MoveFlagCapture
-	}
+	g.Play(move, PGNAnnotation{})
 
-	if p.Type() == King && abs(move.From.File()-move.To.File()) > 1 {
-		if move.To.File() == FileC {
-			move.Flags |= MoveFlagCastleQueenside
-		} else {
-			move.Flags |= MoveFlagCastleKingside
-		}
-	}
+	return nil
+}
 
+// Play makes a move and records it in the game's move list, unlike MakeMove
+// which is used for exploring variations during search.
+func (g *Game) Play(move Move, annotation PGNAnnotation) {
 	g.MakeMove(move)
 
-	g.moves = append(g.moves, uci)
-
-	return true
+	g.moves = append(g.moves, move.String())
+	g.annotations = append(g.annotations, annotation)
 }
 
 func (g *Game) UnmakeMove() {
-	g.boards = g.boards[:len(g.boards)-1]
+	last := g.history[len(g.history)-1]
+	g.history = g.history[:len(g.history)-1]
+
+	if last.Move.IsZero() {
+		g.board.UnmakeNull(last.Undo)
+	} else {
+		g.board.Unmake(last.Move, last.Undo)
+	}
 }
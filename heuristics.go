@@ -0,0 +1,53 @@
+package main
+
+type SearchHeuristics struct {
+	Killers  [SearchMaxPly + 1][2]Move
+	History  [ColorCount][SquareCount][SquareCount]int
+	Counters [SquareCount][SquareCount]Move
+}
+
+const SearchHistoryMax = 1 << 26
+
+func (h *SearchHeuristics) Clear() {
+	*h = SearchHeuristics{}
+}
+
+// Age prepares the heuristics for a new search. Killers only make sense for
+// the positions of the previous search, so they're cleared, while history is
+// halved to favour moves that are good now.
+func (h *SearchHeuristics) Age() {
+	h.Killers = [SearchMaxPly + 1][2]Move{}
+	h.ageHistory()
+}
+
+func (h *SearchHeuristics) ageHistory() {
+	for color := range h.History {
+		for from := range h.History[color] {
+			for to := range h.History[color][from] {
+				h.History[color][from][to] /= 2
+			}
+		}
+	}
+}
+
+func (h *SearchHeuristics) Update(b *Board, ply, depth int, move Move) {
+	if move.Flags&(MoveFlagCapture|MoveFlagPromoteAny) != 0 {
+		return
+	}
+
+	if h.Killers[ply][0] != move {
+		h.Killers[ply][1] = h.Killers[ply][0]
+		h.Killers[ply][0] = move
+	}
+
+	if last := b.Moves.Last; !last.IsZero() {
+		h.Counters[last.From][last.To] = move
+	}
+
+	history := &h.History[b.Player][move.From][move.To]
+
+	// only scale history down mid-search, the killers are still in use
+	if *history += depth * depth; *history >= SearchHistoryMax {
+		h.ageHistory()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchHeuristicsUpdate(t *testing.T) {
+	game, err := GameFromFEN(BoardStartPos)
+	require.NoError(t, err)
+	require.NoError(t, game.MakeUCIMove("e2e4"))
+
+	b := game.Board()
+	h := &SearchHeuristics{}
+
+	first := NewMove(SquareG8, SquareF6)
+	second := NewMove(SquareB8, SquareC6)
+
+	h.Update(b, 2, 3, first)
+	h.Update(b, 2, 4, second)
+	h.Update(b, 2, 4, second)
+
+	assert.Equal(t, [2]Move{second, first}, h.Killers[2], "repeating a killer doesn't push out the other")
+	assert.Equal(t, second, h.Counters[SquareE2][SquareE4])
+	assert.Equal(t, 9, h.History[Black][SquareG8][SquareF6])
+	assert.Equal(t, 32, h.History[Black][SquareB8][SquareC6])
+
+	t.Run("captures", func(t *testing.T) {
+		h := &SearchHeuristics{}
+		h.Update(b, 0, 3, NewMove(SquareD7, SquareD5, MoveFlagCapture))
+
+		assert.Equal(t, SearchHeuristics{}, *h)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		h := *h
+		h.History[Black][SquareG8][SquareF6] = SearchHistoryMax - 1
+
+		h.Update(b, 5, 2, first)
+
+		// history is scaled down, but this search's killers are kept
+		assert.Equal(t, (SearchHistoryMax+3)/2, h.History[Black][SquareG8][SquareF6])
+		assert.Equal(t, 16, h.History[Black][SquareB8][SquareC6])
+		assert.Equal(t, [2]Move{second, first}, h.Killers[2])
+		assert.Equal(t, first, h.Killers[5][0])
+		assert.Equal(t, first, h.Counters[SquareE2][SquareE4])
+	})
+
+	t.Run("age", func(t *testing.T) {
+		h := *h
+		h.Age()
+
+		assert.Equal(t, [2]Move{}, h.Killers[2])
+		assert.Equal(t, 4, h.History[Black][SquareG8][SquareF6])
+		assert.Equal(t, second, h.Counters[SquareE2][SquareE4])
+	})
+}
@@ -23,8 +23,12 @@ func run(ctx context.Context) error {
 	defer cancel()
 
 	var cli struct {
-		UCI       *UCI      `cmd:"" default:"" help:"Run UCI engine"`
-		GenMagics *MagicGen `cmd:"" help:"Generate magic bitboards"`
+		UCI       *UCI         `cmd:"" default:"" help:"Run UCI engine"`
+		GenMagics *MagicGen    `cmd:"" help:"Generate magic bitboards"`
+		EPD       *EPDRunner   `cmd:"" name:"epd" help:"Run an EPD test suite"`
+		Bench     *BenchRunner `cmd:"" help:"Search a fixed set of positions and report a node count signature"`
+		Perft     *PerftRunner `cmd:"" help:"Count the leaf nodes of the move generation tree"`
+		Book      *BookRunner  `cmd:"" help:"Build and inspect opening books"`
 		Log       struct {
 			Level slog.Level `help:"Set the log level" enum:"DEBUG,INFO,WARN,ERROR" default:"DEBUG"`
 		} `embed:"" prefix:"log-"`
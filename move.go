@@ -1,7 +1,7 @@
 package main
 
 import (
-	"slices"
+	"fmt"
 	"strings"
 )
 
@@ -45,6 +45,10 @@ const (
 )
 
 func (m Move) String() string {
+	if m.IsZero() {
+		return "0000"
+	}
+
 	s := strings.Builder{}
 
 	s.WriteString(m.From.String())
@@ -77,12 +81,98 @@ func (m Move) Promotion() (PieceType, bool) {
 	return 0, false
 }
 
+var ErrInvalidMove = fmt.Errorf("invalid move")
+
+func ParseUCIMove(b *Board, s string) (Move, error) {
+	if len(s) < 4 || len(s) > 5 {
+		return Move{}, fmt.Errorf("%w: expected 4 or 5 characters: %q", ErrInvalidMove, s)
+	}
+
+	from, ok := SquareFromString(s[:2])
+	if !ok {
+		return Move{}, fmt.Errorf("%w: invalid source square: %q", ErrInvalidMove, s)
+	}
+
+	to, ok := SquareFromString(s[2:4])
+	if !ok {
+		return Move{}, fmt.Errorf("%w: invalid target square: %q", ErrInvalidMove, s)
+	}
+
+	promotion := PieceType(0)
+
+	if len(s) == 5 {
+		switch s[4] {
+		case 'q':
+			promotion = Queen
+
+		case 'r':
+			promotion = Rook
+
+		case 'b':
+			promotion = Bishop
+
+		case 'n':
+			promotion = Knight
+
+		default:
+			return Move{}, fmt.Errorf("%w: invalid promotion: %q", ErrInvalidMove, s)
+		}
+	}
+
+	// flags come from the generator so a legal match is always consistent
+	// with the board it is made on
+	var buffer [32]Move
+
+	for _, move := range AppendMoves(b, buffer[:0], MoveGenerationOptions{From: from.Bitboard()}) {
+		if move.To != to {
+			continue
+		}
+
+		if p, _ := move.Promotion(); p == promotion {
+			return move, nil
+		}
+	}
+
+	return Move{}, fmt.Errorf("%w: illegal in position %s: %s", ErrInvalidMove, b.FEN(), s)
+}
+
 type MoveGenerationOptions struct {
+	// CapturesOnly generates captures, including capturing promotions.
 	CapturesOnly bool
+	// NoisyOnly generates captures and all promotions.
+	NoisyOnly bool
+	// QuietsOnly generates everything NoisyOnly excludes.
+	QuietsOnly bool
+	// From restricts generation to pieces on these squares, zero means all.
+	From Bitboard
+}
+
+func (opts MoveGenerationOptions) captures() bool {
+	return !opts.QuietsOnly
+}
+
+func (opts MoveGenerationOptions) quiets() bool {
+	return !opts.CapturesOnly && !opts.NoisyOnly
+}
+
+func (opts MoveGenerationOptions) promotions() bool {
+	return !opts.CapturesOnly && !opts.QuietsOnly
+}
+
+func (opts MoveGenerationOptions) sources(b *Board) Bitboard {
+	if opts.From == 0 {
+		return b.Bits.Players[b.Player]
+	}
+
+	return opts.From.And(b.Bits.Players[b.Player])
 }
 
 func GenerateMoves(b *Board, opts MoveGenerationOptions) []Move {
-	moves := GenerateKingMoves(b, make([]Move, 0, 256), opts)
+	return AppendMoves(b, make([]Move, 0, 256), opts)
+}
+
+func AppendMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Move {
+	moves = GenerateKingMoves(b, moves, opts)
 
 	if b.Attacks.Checks < 2 {
 		moves = GenerateSlidingMoves(b, moves, opts)
@@ -93,24 +183,42 @@ func GenerateMoves(b *Board, opts MoveGenerationOptions) []Move {
 	return moves
 }
 
+func IsLegalMove(b *Board, move Move) bool {
+	buf := [32]Move{}
+
+	for _, m := range AppendMoves(b, buf[:0], MoveGenerationOptions{From: move.From.Bitboard()}) {
+		if m == move {
+			return true
+		}
+	}
+
+	return false
+}
+
 var KingMoves = KingAttacks
 
 func GenerateKingMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Move {
 	src := b.Kings[b.Player]
 
+	if !opts.sources(b).IsOccupied(src) {
+		return moves
+	}
+
 	legal := KingMoves[src].
 		Clear(b.Bits.Players[b.Player]).
 		Clear(b.Attacks.All)
 
 	for dst := range legal.Occupied() {
 		if b.Bits.Players[b.Player.Opponent()].IsOccupied(dst) {
-			moves = append(moves, NewMove(src, dst, MoveFlagCapture))
-		} else if !opts.CapturesOnly {
+			if opts.captures() {
+				moves = append(moves, NewMove(src, dst, MoveFlagCapture))
+			}
+		} else if opts.quiets() {
 			moves = append(moves, NewMove(src, dst))
 		}
 	}
 
-	if opts.CapturesOnly {
+	if !opts.quiets() {
 		return moves
 	}
 
@@ -152,13 +260,15 @@ func GenerateKingMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 }
 
 func GenerateSlidingMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Move {
+	sources := opts.sources(b)
+
 	orthogonal := b.Bits.Pieces[Rook].
 		Set(b.Bits.Pieces[Queen]).
-		And(b.Bits.Players[b.Player])
+		And(sources)
 
 	diagonal := b.Bits.Pieces[Bishop].
 		Set(b.Bits.Pieces[Queen]).
-		And(b.Bits.Players[b.Player])
+		And(sources)
 
 	if b.Attacks.Checks > 0 {
 		// can't move pinned pieces when in check
@@ -168,8 +278,10 @@ func GenerateSlidingMoves(b *Board, moves []Move, opts MoveGenerationOptions) []
 
 	legal := b.Attacks.CheckRays.Clear(b.Bits.Players[b.Player])
 
-	if opts.CapturesOnly {
+	if !opts.quiets() {
 		legal = legal.And(b.Bits.Players[b.Player.Opponent()])
+	} else if !opts.captures() {
+		legal = legal.Clear(b.Bits.Players[b.Player.Opponent()])
 	}
 
 	for src := range orthogonal.Occupied() {
@@ -211,14 +323,16 @@ var KnightMoves = KnightAttacks
 
 func GenerateKnightMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Move {
 	knights := b.Bits.Pieces[Knight].
-		And(b.Bits.Players[b.Player]).
+		And(opts.sources(b)).
 		Clear(b.Attacks.Pins)
 
 	legal := b.Attacks.CheckRays.
 		Clear(b.Bits.Players[b.Player])
 
-	if opts.CapturesOnly {
+	if !opts.quiets() {
 		legal = legal.And(b.Bits.Players[b.Player.Opponent()])
+	} else if !opts.captures() {
+		legal = legal.Clear(b.Bits.Players[b.Player.Opponent()])
 	}
 
 	for src := range knights.Occupied() {
@@ -243,14 +357,14 @@ func GeneratePawnMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 		dir = South
 	}
 
-	pawns := b.Bits.Pieces[Pawn].And(b.Bits.Players[b.Player])
+	pawns := b.Bits.Pieces[Pawn].And(opts.sources(b))
 
 	for src := range pawns.Occupied() {
 		if b.Attacks.Checks > 0 && b.Attacks.IsPinned(src) {
 			continue
 		}
 
-		if !opts.CapturesOnly {
+		if opts.quiets() || opts.promotions() {
 			dst := src + dir.Offset()
 
 			if b.Bits.All.IsOccupied(dst) {
@@ -263,18 +377,24 @@ func GeneratePawnMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 
 			if b.Attacks.CheckRays.IsOccupied(dst) {
 				if dst.Rank() == Rank1 || dst.Rank() == Rank8 {
-					moves = append(
-						moves,
-						NewMove(src, dst, MoveFlagPromoteToQueen),
-						NewMove(src, dst, MoveFlagPromoteToRook),
-						NewMove(src, dst, MoveFlagPromoteToBishop),
-						NewMove(src, dst, MoveFlagPromoteToKnight),
-					)
-				} else {
+					if opts.promotions() {
+						moves = append(
+							moves,
+							NewMove(src, dst, MoveFlagPromoteToQueen),
+							NewMove(src, dst, MoveFlagPromoteToRook),
+							NewMove(src, dst, MoveFlagPromoteToBishop),
+							NewMove(src, dst, MoveFlagPromoteToKnight),
+						)
+					}
+				} else if opts.quiets() {
 					moves = append(moves, NewMove(src, dst))
 				}
 			}
 
+			if !opts.quiets() {
+				goto captures
+			}
+
 			dst += dir.Offset()
 
 			if dst.Valid() && b.Attacks.CheckRays.IsOccupied(dst) {
@@ -287,14 +407,12 @@ func GeneratePawnMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 		}
 
 	captures:
-		enemies := b.Bits.Players[b.Player.Opponent()]
-
-		if b.EnPassant != 0 {
-			enemies = enemies.Occupy(b.EnPassant)
+		if !opts.captures() {
+			continue
 		}
 
 		attacks := PawnAttacks[b.Player][src].
-			And(enemies).
+			And(b.Bits.Players[b.Player.Opponent()]).
 			And(b.Attacks.CheckRays)
 
 		if b.Attacks.IsPinned(src) {
@@ -302,9 +420,7 @@ func GeneratePawnMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 		}
 
 		for dst := range attacks.Occupied() {
-			if b.EnPassant != 0 && dst == b.EnPassant {
-				moves = append(moves, NewMove(src, dst, MoveFlagCapture, MoveFlagCaptureEnPassant))
-			} else if dst.Rank() == Rank1 || dst.Rank() == Rank8 {
+			if dst.Rank() == Rank1 || dst.Rank() == Rank8 {
 				moves = append(
 					moves,
 					NewMove(src, dst, MoveFlagCapture|MoveFlagPromoteToQueen),
@@ -316,11 +432,48 @@ func GeneratePawnMoves(b *Board, moves []Move, opts MoveGenerationOptions) []Mov
 				moves = append(moves, NewMove(src, dst, MoveFlagCapture))
 			}
 		}
+
+		if b.EnPassant != 0 && PawnAttacks[b.Player][src].IsOccupied(b.EnPassant) && IsLegalEnPassant(b, src) {
+			moves = append(moves, NewMove(src, b.EnPassant, MoveFlagCapture, MoveFlagCaptureEnPassant))
+		}
 	}
 
 	return moves
 }
 
+func IsLegalEnPassant(b *Board, src Square) bool {
+	dst := b.EnPassant
+	target := NewSquare(dst.File(), src.Rank())
+
+	// the capture must either block or remove the checking piece
+	if !b.Attacks.CheckRays.IsOccupied(dst) && !b.Attacks.CheckRays.IsOccupied(target) {
+		return false
+	}
+
+	// both pawns leave the rank at once, so check the king isn't exposed to a
+	// slider rather than relying on the pins computed for single pieces
+	occupied := b.Bits.All.
+		Unoccupy(src).
+		Unoccupy(target).
+		Occupy(dst)
+
+	enemies := b.Bits.Players[b.Player.Opponent()]
+	orthogonal := b.Bits.Pieces[Rook].Set(b.Bits.Pieces[Queen]).And(enemies)
+	diagonal := b.Bits.Pieces[Bishop].Set(b.Bits.Pieces[Queen]).And(enemies)
+
+	king := b.Kings[b.Player]
+
+	if MagicOrthogonalMoves(king, occupied).AnySet(orthogonal) {
+		return false
+	}
+
+	if MagicDiagonalMoves(king, occupied).AnySet(diagonal) {
+		return false
+	}
+
+	return true
+}
+
 func ScoreMove(board *Board, move Move) int {
 	if move.Flags&MoveFlagCapture == 0 {
 		if move.Flags&MoveFlagPromoteAny == 0 {
@@ -352,26 +505,3 @@ func ScoreMove(board *Board, move Move) int {
 		King:   {Pawn: 0, Knight: 0, Bishop: 0, Rook: 0, Queen: 0, King: 0},
 	}[victim.Type()][attacker.Type()]
 }
-
-func OrderMoves(board *Board, first Move, moves []Move) {
-	slices.SortFunc(moves, func(a, b Move) int {
-		if !first.IsZero() {
-			if a == first {
-				return -1
-			} else if b == first {
-				return 1
-			}
-		}
-
-		as := ScoreMove(board, a)
-		bs := ScoreMove(board, b)
-
-		if as > bs {
-			return -1
-		} else if as < bs {
-			return 1
-		}
-
-		return 0
-	})
-}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUCIMove(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected Move
+	}{
+		{BoardStartPos, "e2e4", NewMove(SquareE2, SquareE4, MoveFlagDoublePawnPush)},
+		{BoardStartPos, "g1f3", NewMove(SquareG1, SquareF3)},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", NewMove(SquareE1, SquareG1, MoveFlagCastleKingside)},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", NewMove(SquareE8, SquareC8, MoveFlagCastleQueenside)},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", NewMove(SquareE5, SquareD6, MoveFlagCapture, MoveFlagCaptureEnPassant)},
+		{"3rk3/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8n", NewMove(SquareE7, SquareD8, MoveFlagCapture, MoveFlagPromoteToKnight)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.move, func(t *testing.T) {
+			b, err := BoardFromFEN(test.fen)
+			require.NoError(t, err)
+
+			move, err := ParseUCIMove(&b, test.move)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, move)
+			assert.Equal(t, test.move, move.String())
+		})
+	}
+}
+
+func TestParseUCIMoveInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "",
+		"short":             "e2e",
+		"long":              "e7e8qq",
+		"bad square":        "e9e4",
+		"bad promotion":     "e2e4k",
+		"no piece":          "e3e4",
+		"opponent piece":    "e8d8",
+		"illegal":           "e2e5",
+		"missing promotion": "a7a8",
+	}
+
+	b, err := BoardFromFEN("4k3/P7/8/8/8/8/4P3/4K3 w - - 0 1")
+	require.NoError(t, err)
+
+	for name, move := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseUCIMove(&b, move)
+			assert.ErrorIs(t, err, ErrInvalidMove)
+		})
+	}
+}
+
+func TestGenerateMovesEnPassant(t *testing.T) {
+	capture := func(from, to Square) Move {
+		return NewMove(from, to, MoveFlagCapture, MoveFlagCaptureEnPassant)
+	}
+
+	tests := map[string]struct {
+		fen   string
+		move  Move
+		legal bool
+	}{
+		"plain": {"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", capture(SquareE5, SquareD6), true},
+		// the pushed pawn gives check, and taking it is the only way out
+		"captures checker": {"8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1", capture(SquareE4, SquareD3), true},
+		// both pawns leave the rank, exposing the king to the rook
+		"rank pin": {"8/8/8/K2pP2r/8/8/8/7k w - d6 0 1", capture(SquareE5, SquareD6), false},
+		// the pawn moves along the diagonal it's pinned on
+		"diagonal pin": {"7k/2b5/8/3pP3/5K2/8/8/8 w - d6 0 1", capture(SquareE5, SquareD6), true},
+		// the captured pawn was shielding the king from the bishop
+		"exposes diagonal": {"7k/5b2/8/3pP3/8/1K6/8/8 w - d6 0 1", capture(SquareE5, SquareD6), false},
+		"ignores check":    {"4k3/8/8/3pP3/8/8/8/4K2r w - d6 0 1", capture(SquareE5, SquareD6), false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := BoardFromFEN(test.fen)
+			require.NoError(t, err)
+
+			moves := GenerateMoves(&b, MoveGenerationOptions{})
+
+			if test.legal {
+				assert.Contains(t, moves, test.move)
+			} else {
+				assert.NotContains(t, moves, test.move)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	_ "embed"
+	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -26,54 +30,243 @@ var _OpeningBook []byte
 
 const OpeningBookStartPos = 900
 
-func RandomOpeningMove(moves ...string) *OpeningMove {
-	available := AvaiableOpeningMoves(moves...)
-	if len(available) == 0 {
-		return nil
+var ErrInvalidOpeningBook = fmt.Errorf("invalid opening book")
+
+// _OpeningIndex maps positions to the book moves available in them, built
+// from the embedded book the first time it's needed.
+var _OpeningIndex = sync.OnceValues(func() (map[uint64][]OpeningMove, error) {
+	return IndexOpeningBook(_OpeningBook)
+})
+
+// IndexOpeningBook walks an ABK tree once and maps positions to their book
+// moves, so positions reached by a different move order or from a FEN still
+// find their moves. Positions are keyed by PolyglotKey rather than
+// Board.Zobrist, which would tell transpositions apart by an en passant square
+// nobody can capture on.
+func IndexOpeningBook(book []byte) (map[uint64][]OpeningMove, error) {
+	index := make(map[uint64][]OpeningMove)
+
+	err := WalkOpeningBook(book, func(game *Game, _ int, opening *OpeningMove) {
+		addOpeningMove(index, PolyglotKey(game.Board()), *opening)
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return available[rand.Intn(len(available))]
+	return index, nil
 }
 
-func AvaiableOpeningMoves(moves ...string) []*OpeningMove {
-	move := FindOpeningMove(moves...)
-	if move == nil {
+// WalkOpeningBook visits every move in an ABK tree depth first, with the game
+// at the position the move is played from and the number of plies leading up
+// to it. Every pointer is checked before it's followed, so a corrupt book
+// returns an error instead of reading out of bounds or looping forever.
+func WalkOpeningBook(book []byte, visit func(game *Game, depth int, opening *OpeningMove)) error {
+	size := unsafe.Sizeof(OpeningMove{})
+
+	if uintptr(len(book))%size != 0 || uintptr(len(book)) < OpeningBookStartPos*size {
+		return fmt.Errorf("%w: size %d is not a header and whole entries", ErrInvalidOpeningBook, len(book))
+	}
+
+	game, err := GameFromFEN(BoardStartPos)
+	if err != nil {
+		return err
+	}
+
+	// a book with no moves is just a header
+	if uintptr(len(book)) == OpeningBookStartPos*size {
 		return nil
 	}
 
-	available := []*OpeningMove(nil)
+	return walkOpeningBook(book, game, 0, OpeningBookStartPos, make(map[int32]bool), visit)
+}
+
+func walkOpeningBook(book []byte, game *Game, depth int, first int32, visited map[int32]bool, visit func(*Game, int, *OpeningMove)) error {
+	entries := int32(uintptr(len(book)) / unsafe.Sizeof(OpeningMove{}))
 
-	for s := move; s != nil; s = s.Sibling() {
-		available = append(available, s)
+	for i := first; i > 0; {
+		if i < OpeningBookStartPos || i >= entries {
+			return fmt.Errorf("%w: entry %d out of bounds [%d, %d)", ErrInvalidOpeningBook, i, OpeningBookStartPos, entries)
+		}
+
+		// every entry has one parent, so seeing one twice means a cycle or
+		// two branches sharing a subtree
+		if visited[i] {
+			return fmt.Errorf("%w: entry %d reached twice", ErrInvalidOpeningBook, i)
+		}
+
+		visited[i] = true
+
+		opening := openingMoveAt(book, uintptr(i))
+
+		move, err := ParseUCIMove(game.Board(), opening.String())
+		if err != nil {
+			return fmt.Errorf("%w: entry %d: %w", ErrInvalidOpeningBook, i, err)
+		}
+
+		visit(game, depth, opening)
+
+		if opening.next > 0 {
+			game.MakeMove(move)
+			err := walkOpeningBook(book, game, depth+1, opening.next, visited, visit)
+			game.UnmakeMove()
+
+			if err != nil {
+				return err
+			}
+		}
+
+		i = opening.sibling
+	}
+
+	return nil
+}
+
+// addOpeningMove merges the statistics of moves reached through different
+// move orders, since each path through the tree counts different games.
+func addOpeningMove(index map[uint64][]OpeningMove, key uint64, opening OpeningMove) {
+	moves := index[key]
+
+	for i := range moves {
+		if moves[i].From == opening.From && moves[i].To == opening.To && moves[i].Promotion == opening.Promotion {
+			moves[i].Games += opening.Games
+			moves[i].Won += opening.Won
+			moves[i].Lost += opening.Lost
+			moves[i].Priority = max(moves[i].Priority, opening.Priority)
+			return
+		}
 	}
 
-	return available
+	index[key] = append(moves, opening)
+}
+
+type OpeningPolicy string
+
+const (
+	// OpeningPolicyUniform picks any book move with equal probability.
+	OpeningPolicyUniform OpeningPolicy = "uniform"
+	// OpeningPolicyBest always plays the move with the best score, preferring
+	// the most played move on ties.
+	OpeningPolicyBest OpeningPolicy = "best"
+	// OpeningPolicyGames picks moves in proportion to how often they were played.
+	OpeningPolicyGames OpeningPolicy = "games"
+	// OpeningPolicyScore picks moves in proportion to their score.
+	OpeningPolicyScore OpeningPolicy = "score"
+	// OpeningPolicyPriority picks moves in proportion to their priority.
+	OpeningPolicyPriority OpeningPolicy = "priority"
+)
+
+var OpeningPolicies = []string{
+	string(OpeningPolicyUniform),
+	string(OpeningPolicyBest),
+	string(OpeningPolicyGames),
+	string(OpeningPolicyScore),
+	string(OpeningPolicyPriority),
+}
+
+type OpeningSelector struct {
+	Policy OpeningPolicy
+	// MinGames skips moves played in fewer games, whatever the policy.
+	MinGames int
+	Rand     *rand.Rand
 }
 
-func OpeningMoveAt(index uintptr) *OpeningMove {
-	return (*OpeningMove)(unsafe.Pointer(&_OpeningBook[index*unsafe.Sizeof(OpeningMove{})]))
+// NewOpeningSelector returns a selector whose choices are reproducible for a
+// non-zero seed.
+func NewOpeningSelector(policy OpeningPolicy, minGames int, seed int64) *OpeningSelector {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &OpeningSelector{
+		Policy:   policy,
+		MinGames: minGames,
+		Rand:     rand.New(rand.NewSource(seed)),
+	}
 }
 
-func FindOpeningMove(moves ...string) *OpeningMove {
-	opening := OpeningMoveAt(OpeningBookStartPos)
+func (s *OpeningSelector) Select(moves []OpeningMove) *OpeningMove {
+	moves = slices.DeleteFunc(slices.Clone(moves), func(m OpeningMove) bool {
+		return int(m.Games) < s.MinGames
+	})
+
+	if len(moves) == 0 {
+		return nil
+	}
+
+	weight := func(*OpeningMove) float64 { return 1 }
 
-	for _, move := range moves {
-		found := false
+	switch s.Policy {
+	case OpeningPolicyBest:
+		best := &moves[0]
 
-		for o := opening; o != nil; o = o.Sibling() {
-			if move == o.String() {
-				opening = o.Next()
-				found = true
-				break
+		for i := range moves[1:] {
+			m := &moves[i+1]
+
+			if m.Score() > best.Score() || m.Score() == best.Score() && m.Games > best.Games {
+				best = m
 			}
 		}
 
-		if !found {
-			return nil
+		return best
+
+	case OpeningPolicyGames:
+		weight = func(m *OpeningMove) float64 { return float64(m.Games) }
+
+	case OpeningPolicyScore:
+		weight = (*OpeningMove).Score
+
+	case OpeningPolicyPriority:
+		weight = func(m *OpeningMove) float64 { return float64(max(m.Priority, 0)) }
+	}
+
+	total := 0.0
+
+	for i := range moves {
+		total += weight(&moves[i])
+	}
+
+	// moves with no weight are never played, so there may be nothing left
+	if total <= 0 {
+		return nil
+	}
+
+	n := s.Rand.Float64() * total
+	last := -1
+
+	for i := range moves {
+		if weight(&moves[i]) <= 0 {
+			continue
 		}
+
+		if n -= weight(&moves[i]); n < 0 {
+			return &moves[i]
+		}
+
+		last = i
+	}
+
+	// rounding can leave a sliver of the total unaccounted for
+	return &moves[last]
+}
+
+// OpeningMoves returns the book moves for a position, however it was reached.
+func OpeningMoves(b *Board) ([]OpeningMove, error) {
+	index, err := _OpeningIndex()
+	if err != nil {
+		return nil, err
 	}
 
-	return opening
+	return slices.Clone(index[PolyglotKey(b)]), nil
+}
+
+// ValidateOpeningBook checks every pointer and move in an ABK book.
+func ValidateOpeningBook(book []byte) error {
+	return WalkOpeningBook(book, func(*Game, int, *OpeningMove) {})
+}
+
+func openingMoveAt(book []byte, index uintptr) *OpeningMove {
+	return (*OpeningMove)(unsafe.Pointer(&book[index*unsafe.Sizeof(OpeningMove{})]))
 }
 
 func (m *OpeningMove) String() string {
@@ -99,18 +292,14 @@ func (m *OpeningMove) String() string {
 	return s.String()
 }
 
-func (m *OpeningMove) Next() *OpeningMove {
-	if m.next <= 0 {
-		return nil
+// Score returns the fraction of points scored by the side playing the move,
+// counting draws as half a point.
+func (m *OpeningMove) Score() float64 {
+	if m.Games <= 0 {
+		return 0
 	}
 
-	return OpeningMoveAt(uintptr(m.next))
-}
-
-func (m *OpeningMove) Sibling() *OpeningMove {
-	if m.sibling <= 0 {
-		return nil
-	}
+	draws := m.Games - m.Won - m.Lost
 
-	return OpeningMoveAt(uintptr(m.sibling))
+	return (float64(m.Won) + float64(draws)/2) / float64(m.Games)
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpeningMoves(t *testing.T) {
+	play := func(t *testing.T, moves ...string) *Game {
+		game, err := GameFromFEN(BoardStartPos)
+		require.NoError(t, err)
+
+		for _, move := range moves {
+			require.NoError(t, game.MakeUCIMove(move))
+		}
+
+		return game
+	}
+
+	t.Run("start position", func(t *testing.T) {
+		game := play(t)
+
+		moves, err := OpeningMoves(game.Board())
+		require.NoError(t, err)
+		require.NotEmpty(t, moves)
+
+		for _, opening := range moves {
+			_, err := ParseUCIMove(game.Board(), opening.String())
+			assert.NoError(t, err, opening.String())
+		}
+	})
+
+	t.Run("transposition", func(t *testing.T) {
+		direct := play(t, "e2e4", "e7e5", "g1f3", "b8c6")
+		transposed := play(t, "g1f3", "b8c6", "e2e4", "e7e5")
+
+		// only the en passant square differs, and nothing can capture on it
+		require.NotEqual(t, direct.FEN(), transposed.FEN())
+
+		moves, err := OpeningMoves(transposed.Board())
+		require.NoError(t, err)
+		assert.NotEmpty(t, moves)
+
+		expected, err := OpeningMoves(direct.Board())
+		require.NoError(t, err)
+		assert.Equal(t, expected, moves)
+	})
+
+	t.Run("fen", func(t *testing.T) {
+		game, err := GameFromFEN(play(t, "d2d4", "g8f6").FEN())
+		require.NoError(t, err)
+
+		assert.Empty(t, game.Moves())
+
+		moves, err := OpeningMoves(game.Board())
+		require.NoError(t, err)
+		assert.NotEmpty(t, moves)
+	})
+
+	t.Run("out of book", func(t *testing.T) {
+		game, err := GameFromFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+		require.NoError(t, err)
+
+		moves, err := OpeningMoves(game.Board())
+		require.NoError(t, err)
+		assert.Empty(t, moves)
+	})
+}
+
+func TestOpeningSelector(t *testing.T) {
+	moves := []OpeningMove{
+		{From: SquareE2, To: SquareE4, Priority: 9, Games: 100, Won: 40, Lost: 40},
+		{From: SquareD2, To: SquareD4, Priority: 4, Games: 50, Won: 30, Lost: 10},
+		{From: SquareC2, To: SquareC4, Priority: 0, Games: 5, Won: 5},
+		{From: SquareG2, To: SquareG4, Priority: 1, Games: 10, Lost: 10},
+	}
+
+	count := func(policy OpeningPolicy, minGames int) map[string]int {
+		selector := NewOpeningSelector(policy, minGames, 1)
+		seen := map[string]int{}
+
+		for range 2000 {
+			move := selector.Select(moves)
+			require.NotNil(t, move)
+
+			seen[move.String()]++
+		}
+
+		return seen
+	}
+
+	t.Run("uniform", func(t *testing.T) {
+		assert.Len(t, count(OpeningPolicyUniform, 0), 4)
+	})
+
+	t.Run("best", func(t *testing.T) {
+		assert.Equal(t, map[string]int{"c2c4": 2000}, count(OpeningPolicyBest, 0))
+		assert.Equal(t, map[string]int{"d2d4": 2000}, count(OpeningPolicyBest, 10))
+	})
+
+	t.Run("games", func(t *testing.T) {
+		seen := count(OpeningPolicyGames, 0)
+
+		assert.Greater(t, seen["e2e4"], seen["d2d4"])
+		assert.Greater(t, seen["d2d4"], seen["g2g4"])
+		assert.Greater(t, seen["g2g4"], seen["c2c4"])
+	})
+
+	t.Run("score", func(t *testing.T) {
+		seen := count(OpeningPolicyScore, 0)
+
+		assert.Zero(t, seen["g2g4"], "moves that always lose are never played")
+		assert.Greater(t, seen["c2c4"], seen["e2e4"])
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		seen := count(OpeningPolicyPriority, 0)
+
+		assert.Zero(t, seen["c2c4"], "moves without priority are never played")
+		assert.Greater(t, seen["e2e4"], seen["d2d4"])
+		assert.Greater(t, seen["d2d4"], seen["g2g4"])
+	})
+
+	t.Run("min games", func(t *testing.T) {
+		seen := count(OpeningPolicyUniform, 50)
+
+		assert.Len(t, seen, 2)
+		assert.Nil(t, NewOpeningSelector(OpeningPolicyUniform, 1000, 1).Select(moves))
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		a := NewOpeningSelector(OpeningPolicyUniform, 0, 42)
+		b := NewOpeningSelector(OpeningPolicyUniform, 0, 42)
+
+		for range 100 {
+			assert.Equal(t, a.Select(moves).String(), b.Select(moves).String())
+		}
+	})
+}
+
+func TestValidateOpeningBook(t *testing.T) {
+	require.NoError(t, ValidateOpeningBook(_OpeningBook))
+
+	corrupt := func(modify func(book []byte)) []byte {
+		book := slices.Clone(_OpeningBook)
+		modify(book)
+
+		return book
+	}
+
+	tests := map[string][]byte{
+		"truncated": _OpeningBook[:len(_OpeningBook)-1],
+		"pointer into header": corrupt(func(book []byte) {
+			openingMoveAt(book, OpeningBookStartPos).next = 10
+		}),
+		"out of bounds": corrupt(func(book []byte) {
+			openingMoveAt(book, OpeningBookStartPos).sibling = math.MaxInt32
+		}),
+		"cycle": corrupt(func(book []byte) {
+			openingMoveAt(book, OpeningBookStartPos+1).next = OpeningBookStartPos
+		}),
+		"illegal move": corrupt(func(book []byte) {
+			openingMoveAt(book, OpeningBookStartPos).To = SquareE5
+		}),
+	}
+
+	for name, book := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, ValidateOpeningBook(book), ErrInvalidOpeningBook)
+
+			_, err := IndexOpeningBook(book)
+			assert.ErrorIs(t, err, ErrInvalidOpeningBook)
+		})
+	}
+}
+
+func TestStatOpeningBook(t *testing.T) {
+	stats, err := StatOpeningBook(_OpeningBook)
+	require.NoError(t, err)
+
+	assert.Equal(t, len(_OpeningBook), stats.Bytes)
+	assert.Equal(t, len(_OpeningBook)/int(unsafe.Sizeof(OpeningMove{}))-OpeningBookStartPos, stats.Entries+stats.Unreachable)
+	total := 0
+	for _, entries := range stats.Depths {
+		total += entries
+	}
+
+	assert.Equal(t, stats.Entries, total)
+	moves, err := OpeningMoves(testBookBoard(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, len(moves), stats.Depths[0])
+	assert.Positive(t, stats.Leaves)
+	assert.LessOrEqual(t, stats.Positions, stats.Entries)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type UCIOptionType string
+
+const (
+	UCIOptionCheck  UCIOptionType = "check"
+	UCIOptionSpin   UCIOptionType = "spin"
+	UCIOptionCombo  UCIOptionType = "combo"
+	UCIOptionButton UCIOptionType = "button"
+	UCIOptionString UCIOptionType = "string"
+)
+
+type UCIOption struct {
+	Name    string
+	Type    UCIOptionType
+	Default string
+	Min     int
+	Max     int
+	Vars    []string
+
+	set func(string) error
+}
+
+var ErrInvalidOption = fmt.Errorf("invalid option")
+
+func NewUCICheckOption(name string, def bool, set func(bool)) *UCIOption {
+	return &UCIOption{
+		Name:    name,
+		Type:    UCIOptionCheck,
+		Default: strconv.FormatBool(def),
+		set: func(value string) error {
+			switch value {
+			case "true":
+				set(true)
+
+			case "false":
+				set(false)
+
+			default:
+				return fmt.Errorf("%w: %s: expected true or false, got %q", ErrInvalidOption, name, value)
+			}
+
+			return nil
+		},
+	}
+}
+
+func NewUCISpinOption(name string, def, min, max int, set func(int)) *UCIOption {
+	return &UCIOption{
+		Name:    name,
+		Type:    UCIOptionSpin,
+		Default: strconv.Itoa(def),
+		Min:     min,
+		Max:     max,
+		set: func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%w: %s: expected integer, got %q", ErrInvalidOption, name, value)
+			}
+
+			if n < min || n > max {
+				return fmt.Errorf("%w: %s: %d out of range [%d, %d]", ErrInvalidOption, name, n, min, max)
+			}
+
+			set(n)
+
+			return nil
+		},
+	}
+}
+
+func NewUCIComboOption(name, def string, vars []string, set func(string)) *UCIOption {
+	return &UCIOption{
+		Name:    name,
+		Type:    UCIOptionCombo,
+		Default: def,
+		Vars:    vars,
+		set: func(value string) error {
+			index := slices.IndexFunc(vars, func(v string) bool {
+				return strings.EqualFold(v, value)
+			})
+
+			if index == -1 {
+				return fmt.Errorf("%w: %s: expected one of %v, got %q", ErrInvalidOption, name, vars, value)
+			}
+
+			set(vars[index])
+
+			return nil
+		},
+	}
+}
+
+func NewUCIButtonOption(name string, press func()) *UCIOption {
+	return &UCIOption{
+		Name: name,
+		Type: UCIOptionButton,
+		set: func(string) error {
+			press()
+
+			return nil
+		},
+	}
+}
+
+func NewUCIStringOption(name, def string, set func(string) error) *UCIOption {
+	return &UCIOption{
+		Name:    name,
+		Type:    UCIOptionString,
+		Default: def,
+		set: func(value string) error {
+			if value == "<empty>" {
+				value = ""
+			}
+
+			return set(value)
+		},
+	}
+}
+
+func (o *UCIOption) String() string {
+	s := strings.Builder{}
+
+	fmt.Fprintf(&s, "option name %s type %s", o.Name, o.Type)
+
+	switch o.Type {
+	case UCIOptionButton:
+		return s.String()
+
+	case UCIOptionString:
+		if o.Default == "" {
+			s.WriteString(" default <empty>")
+		} else {
+			fmt.Fprintf(&s, " default %s", o.Default)
+		}
+
+	default:
+		fmt.Fprintf(&s, " default %s", o.Default)
+	}
+
+	if o.Type == UCIOptionSpin {
+		fmt.Fprintf(&s, " min %d max %d", o.Min, o.Max)
+	}
+
+	for _, v := range o.Vars {
+		fmt.Fprintf(&s, " var %s", v)
+	}
+
+	return s.String()
+}
+
+func (o *UCIOption) Set(value string) error {
+	return o.set(value)
+}
+
+type UCIOptions []*UCIOption
+
+func (opts UCIOptions) Find(name string) (*UCIOption, bool) {
+	for _, o := range opts {
+		if strings.EqualFold(o.Name, name) {
+			return o, true
+		}
+	}
+
+	return nil, false
+}
+
+func (opts UCIOptions) Set(name, value string) error {
+	o, ok := opts.Find(name)
+	if !ok {
+		return fmt.Errorf("%w: unknown option: %s", ErrInvalidOption, name)
+	}
+
+	return o.Set(value)
+}
@@ -1,34 +1,363 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+	"unsafe"
 )
 
+type PerftOptions struct {
+	// Threads splits the root moves across goroutines, each counting its
+	// share on a clone of the game.
+	Threads int
+	// Divide receives the node count below each root move when set.
+	Divide io.Writer
+	// Table caches subtree counts between positions and calls when set.
+	Table *PerftTable
+}
+
+// perft entries use the same xor'd key scheme as the transposition table so
+// threads can share a table without locking.
+type perftEntry struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+// PerftTable caches node counts keyed by zobrist and remaining depth.
+type PerftTable struct {
+	entries []perftEntry
+}
+
+func NewPerftTable(bytes uintptr) *PerftTable {
+	size := max(1, bytes/unsafe.Sizeof(perftEntry{}))
+
+	return &PerftTable{
+		entries: make([]perftEntry, size),
+	}
+}
+
+func (pt *PerftTable) entry(key Zobrist, depth int) *perftEntry {
+	// mix the depth into the index so counts for different depths of the
+	// same position don't evict each other
+	index := (uint64(key) ^ uint64(depth)*0x9e3779b97f4a7c15) % uint64(len(pt.entries))
+
+	return &pt.entries[index]
+}
+
+func (pt *PerftTable) Get(key Zobrist, depth int) (uint64, bool) {
+	entry := pt.entry(key, depth)
+
+	data := entry.data.Load()
+	if Zobrist(entry.key.Load()^data) != key || int(uint8(data)) != depth {
+		return 0, false
+	}
+
+	return data >> 8, true
+}
+
+func (pt *PerftTable) Store(key Zobrist, depth int, nodes uint64) {
+	data := nodes<<8 | uint64(uint8(depth))
+
+	entry := pt.entry(key, depth)
+	entry.key.Store(uint64(key) ^ data)
+	entry.data.Store(data)
+}
+
 func Perft(game *Game, depth int, divide io.Writer) uint64 {
-	return perft(game, depth, divide, true)
+	return PerftWithOptions(game, depth, PerftOptions{Divide: divide})
 }
 
-func perft(game *Game, depth int, divide io.Writer, root bool) uint64 {
+func PerftWithOptions(game *Game, depth int, opts PerftOptions) uint64 {
 	if depth == 0 {
 		return 1
 	}
 
+	moves := GenerateMoves(game.Board(), MoveGenerationOptions{})
+	counts := make([]uint64, len(moves))
+
+	if opts.Threads <= 1 {
+		for i, move := range moves {
+			game.MakeMove(move)
+			counts[i] = perft(game, depth-1, opts.Table)
+			game.UnmakeMove()
+		}
+	} else {
+		work := make(chan int, len(moves))
+
+		for i := range moves {
+			work <- i
+		}
+
+		close(work)
+
+		wg := sync.WaitGroup{}
+
+		for range min(opts.Threads, len(moves)) {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				game := game.Clone()
+
+				for i := range work {
+					game.MakeMove(moves[i])
+					counts[i] = perft(game, depth-1, opts.Table)
+					game.UnmakeMove()
+				}
+			}()
+		}
+
+		wg.Wait()
+	}
+
 	total := uint64(0)
 
-	for _, move := range GenerateMoves(game.Board(), MoveGenerationOptions{}) {
-		game.MakeMove(move)
+	for i, move := range moves {
+		if opts.Divide != nil {
+			fmt.Fprintf(opts.Divide, "%5s: %d\n", move, counts[i])
+		}
 
-		nodes := perft(game, depth-1, divide, false)
+		total += counts[i]
+	}
 
-		if root && divide != nil {
-			fmt.Fprintf(divide, "%5s: %d\n", move, nodes)
+	return total
+}
+
+func perft(game *Game, depth int, table *PerftTable) uint64 {
+	if depth == 0 {
+		return 1
+	}
+
+	key := game.Board().Zobrist
+
+	if table != nil && depth > 1 {
+		if nodes, ok := table.Get(key, depth); ok {
+			return nodes
 		}
+	}
+
+	moves := GenerateMoves(game.Board(), MoveGenerationOptions{})
 
-		total += nodes
+	// bulk count the leaves instead of making each move
+	if depth == 1 {
+		return uint64(len(moves))
+	}
 
+	total := uint64(0)
+
+	for _, move := range moves {
+		game.MakeMove(move)
+		total += perft(game, depth-1, table)
 		game.UnmakeMove()
 	}
 
+	if table != nil {
+		table.Store(key, depth, total)
+	}
+
 	return total
 }
+
+type PerftRunner struct {
+	FEN     string   `help:"Position to count moves from" default:"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"`
+	Moves   []string `help:"Moves to play from the position before counting"`
+	Depth   int      `help:"Depth to count to, or the maximum depth to verify"`
+	Divide  bool     `help:"Print the node count below each root move"`
+	Threads int      `help:"Number of threads to count with" default:"1"`
+	Hash    int      `help:"Size of the perft hash table in megabytes, 0 to disable" default:"64"`
+	Verify  string   `help:"Verify every position and depth in a perft JSON file" placeholder:"PATH"`
+	Bisect  string   `help:"Find the first mismatch against a reference divide file, - for stdin" placeholder:"PATH"`
+}
+
+func (r *PerftRunner) Run(ctx context.Context) error {
+	if r.Verify != "" {
+		return r.verify(ctx)
+	}
+
+	if r.Depth <= 0 {
+		return fmt.Errorf("depth must be positive, got %d", r.Depth)
+	}
+
+	game, err := GameFromFEN(r.FEN)
+	if err != nil {
+		return err
+	}
+
+	for _, move := range r.Moves {
+		if err := game.MakeUCIMove(move); err != nil {
+			return err
+		}
+	}
+
+	if r.Bisect != "" {
+		return r.bisect(game)
+	}
+
+	opts := r.options()
+	if r.Divide {
+		opts.Divide = os.Stdout
+	}
+
+	start := time.Now()
+	nodes := PerftWithOptions(game, r.Depth, opts)
+	elapsed := time.Since(start)
+
+	if r.Divide {
+		fmt.Println()
+	}
+
+	fmt.Printf("nodes %d time %dms nps %d\n", nodes, elapsed.Milliseconds(), perftNPS(nodes, elapsed))
+
+	return nil
+}
+
+func (r *PerftRunner) verify(ctx context.Context) error {
+	data, err := os.ReadFile(r.Verify)
+	if err != nil {
+		return fmt.Errorf("failed to read perft file: %w", err)
+	}
+
+	tests := map[string][]uint64(nil)
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return fmt.Errorf("failed to decode perft file: %w", err)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "result\tdepth\texpected\tnodes\ttime\tnps\tfen")
+
+	passed, failed := 0, 0
+	opts := r.options()
+
+	for _, fen := range slices.Sorted(maps.Keys(tests)) {
+		counts := tests[fen]
+
+		game, err := GameFromFEN(fen)
+		if err != nil {
+			return err
+		}
+
+		for depth, expected := range counts {
+			if r.Depth > 0 && depth > r.Depth {
+				break
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			start := time.Now()
+			nodes := PerftWithOptions(game, depth, opts)
+			elapsed := time.Since(start)
+
+			result := "pass"
+			if nodes != expected {
+				result = "FAIL"
+				failed++
+			} else {
+				passed++
+			}
+
+			fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%dms\t%d\t%s\n", result, depth, expected, nodes, elapsed.Milliseconds(), perftNPS(nodes, elapsed), fen)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\npassed %d, failed %d\n", passed, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d perft counts did not match", failed)
+	}
+
+	return nil
+}
+
+func (r *PerftRunner) bisect(game *Game) error {
+	input := io.Reader(os.Stdin)
+
+	if r.Bisect != "-" {
+		file, err := os.Open(r.Bisect)
+		if err != nil {
+			return fmt.Errorf("failed to open reference divide: %w", err)
+		}
+
+		defer file.Close()
+
+		input = file
+	}
+
+	reference, err := ReadPerftDivide(input)
+	if err != nil {
+		return fmt.Errorf("failed to read reference divide: %w", err)
+	}
+
+	if len(reference) == 0 {
+		return fmt.Errorf("reference divide has no moves")
+	}
+
+	result, err := BisectPerft(game, r.Depth, reference, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if !result.Found() {
+		if len(result.Path) == 0 {
+			fmt.Println("no mismatch against the reference divide")
+			return nil
+		}
+
+		// the reference disagreed with us at the root, but the built-in
+		// reference generator agrees with us all the way down
+		return fmt.Errorf("no mismatch below %s, the reference divide may be wrong", strings.Join(result.Path, " "))
+	}
+
+	fmt.Println()
+	fmt.Printf("path    %s\n", strings.Join(result.Path, " "))
+	fmt.Printf("fen     %s\n", result.FEN)
+	fmt.Printf("depth   %d\n", result.Depth)
+
+	if len(result.Missing) > 0 {
+		fmt.Printf("missing %s\n", strings.Join(result.Missing, " "))
+	}
+
+	if len(result.Extra) > 0 {
+		fmt.Printf("extra   %s\n", strings.Join(result.Extra, " "))
+	}
+
+	if result.Expected != result.Got {
+		fmt.Printf("count   expected %d, got %d\n", result.Expected, result.Got)
+	}
+
+	return fmt.Errorf("perft mismatch at %s", result.FEN)
+}
+
+func (r *PerftRunner) options() PerftOptions {
+	opts := PerftOptions{Threads: r.Threads}
+
+	if r.Hash > 0 {
+		opts.Table = NewPerftTable(uintptr(r.Hash) * 1024 * 1024)
+	}
+
+	return opts
+}
+
+func perftNPS(nodes uint64, elapsed time.Duration) int {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return int(float64(nodes) / elapsed.Seconds())
+}
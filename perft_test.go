@@ -9,18 +9,28 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestPerft(t *testing.T) {
+// loadPerftPositions returns the positions in testdata/perft.json with their
+// node counts, indexed by depth.
+func loadPerftPositions(t testing.TB) map[string][]uint64 {
+	t.Helper()
+
 	data, err := os.ReadFile("testdata/perft.json")
 	require.NoError(t, err)
 
-	tests := map[string][]uint64(nil)
-	require.NoError(t, json.Unmarshal(data, &tests))
+	positions := map[string][]uint64(nil)
+	require.NoError(t, json.Unmarshal(data, &positions))
+
+	return positions
+}
+
+func TestPerft(t *testing.T) {
+	tests := loadPerftPositions(t)
 
 	for fen, test := range tests {
 		for depth, expected := range test {
-      if testing.Short() && depth > 3 {
-        break
-      }
+			if testing.Short() && depth > 3 {
+				break
+			}
 
 			t.Run(fen, func(t *testing.T) {
 				game, err := GameFromFEN(fen)
@@ -33,3 +43,147 @@ func TestPerft(t *testing.T) {
 		}
 	}
 }
+
+func TestMovePickerPerft(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen, test := range tests {
+		for depth, expected := range test {
+			if depth > 3 {
+				break
+			}
+
+			t.Run(fen, func(t *testing.T) {
+				game, err := GameFromFEN(fen)
+				require.NoError(t, err)
+
+				stack := make([]MovePicker, depth)
+				heuristics := &SearchHeuristics{}
+
+				var perft func(depth int) uint64
+
+				perft = func(depth int) uint64 {
+					if depth == 0 {
+						return 1
+					}
+
+					// use a legal first move and stale killers so every stage
+					// has to dedupe against the others
+					first := Move{}
+					if moves := GenerateMoves(game.Board(), MoveGenerationOptions{}); len(moves) > 0 {
+						first = moves[len(moves)/2]
+					}
+
+					picker := &stack[depth-1]
+					picker.Reset(game.Board(), heuristics, depth-1, first)
+
+					total := uint64(0)
+
+					for move, ok := picker.Next(); ok; move, ok = picker.Next() {
+						game.MakeMove(move)
+						total += perft(depth - 1)
+						game.UnmakeMove()
+
+						heuristics.Update(game.Board(), depth-1, depth, move)
+					}
+
+					return total
+				}
+
+				assert.Equal(t, expected, perft(depth))
+			})
+		}
+	}
+}
+
+func TestMakeUnmake(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			var walk func(depth int)
+
+			walk = func(depth int) {
+				if depth == 0 {
+					return
+				}
+
+				before := *game.Board()
+
+				for _, move := range GenerateMoves(game.Board(), MoveGenerationOptions{}) {
+					game.MakeMove(move)
+
+					require.Equal(t, CalculateZobrist(game.Board()), game.Board().Zobrist, "zobrist after %s", move)
+
+					walk(depth - 1)
+
+					game.UnmakeMove()
+
+					require.Equal(t, before, *game.Board(), "board after unmaking %s", move)
+				}
+			}
+
+			walk(2)
+		})
+	}
+}
+
+func TestPerftParallel(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen, test := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			depth := min(len(test)-1, 3)
+
+			assert.Equal(t, test[depth], PerftWithOptions(game, depth, PerftOptions{Threads: 4}))
+			assert.Equal(t, fen, game.FEN())
+		})
+	}
+}
+
+func TestPerftTable(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	// a small table shared between positions, so entries are overwritten and
+	// keys from different positions collide
+	table := NewPerftTable(64 * 1024)
+
+	for fen, test := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			for depth := 1; depth < min(len(test), 5); depth++ {
+				uncached := Perft(game, depth, nil)
+
+				assert.Equal(t, uncached, PerftWithOptions(game, depth, PerftOptions{Table: table}), "depth %d", depth)
+				assert.Equal(t, uncached, PerftWithOptions(game, depth, PerftOptions{Table: table, Threads: 4}), "depth %d", depth)
+			}
+		})
+	}
+
+	game, err := GameFromFEN(BoardStartPos)
+	require.NoError(t, err)
+
+	table = NewPerftTable(1024 * 1024)
+
+	// the second run is answered from the table
+	assert.Equal(t, uint64(197281), PerftWithOptions(game, 4, PerftOptions{Table: table}))
+	assert.Equal(t, uint64(197281), PerftWithOptions(game, 4, PerftOptions{Table: table}))
+
+	nodes, ok := table.Get(game.Board().Zobrist, 4)
+	assert.False(t, ok, "root counts are not cached")
+	assert.Zero(t, nodes)
+
+	game.MakeMove(NewMove(SquareE2, SquareE4, MoveFlagDoublePawnPush))
+
+	nodes, ok = table.Get(game.Board().Zobrist, 3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(13160), nodes)
+}
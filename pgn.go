@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidPGN = fmt.Errorf("invalid pgn")
+
+const (
+	PGNResultWhite   = "1-0"
+	PGNResultBlack   = "0-1"
+	PGNResultDraw    = "1/2-1/2"
+	PGNResultUnknown = "*"
+
+	PGNLineLength = 80
+)
+
+// PGNSevenTagRoster lists the tags every exported game starts with, in order.
+var PGNSevenTagRoster = []PGNTag{
+	{"Event", "?"},
+	{"Site", "?"},
+	{"Date", "????.??.??"},
+	{"Round", "?"},
+	{"White", "?"},
+	{"Black", "?"},
+	{"Result", PGNResultUnknown},
+}
+
+type PGNTag struct {
+	Name  string
+	Value string
+}
+
+type PGNAnnotation struct {
+	Comment    string
+	NAGs       []int
+	Variations []PGNVariation
+}
+
+type PGNVariation struct {
+	Comment string
+	Moves   []PGNMove
+}
+
+type PGNMove struct {
+	Move Move
+	SAN  string
+
+	PGNAnnotation
+}
+
+// PGNReader replays each game's moves on a Game, resolving SAN against the
+// legal moves in the position. It sits next to the engine rather than in a pgn
+// package because Game, Board and the SAN code are all in package main, which
+// no other package can import.
+type PGNReader struct {
+	r    *bufio.Reader
+	line int
+
+	unread *pgnToken
+	// movetext is set once the current game's tags have been read
+	movetext bool
+}
+
+type pgnTokenKind int
+
+const (
+	pgnTokenEOF pgnTokenKind = iota
+	pgnTokenSymbol
+	pgnTokenString
+	pgnTokenComment
+	pgnTokenNAG
+	pgnTokenPeriod
+	pgnTokenTagOpen
+	pgnTokenTagClose
+	pgnTokenVariationOpen
+	pgnTokenVariationClose
+)
+
+type pgnToken struct {
+	kind pgnTokenKind
+	text string
+}
+
+// pgnSuffixes maps move suffix annotations to their NAG equivalents.
+var pgnSuffixes = map[string]int{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+func NewPGNReader(r io.Reader) *PGNReader {
+	return &PGNReader{
+		r:    bufio.NewReader(r),
+		line: 1,
+	}
+}
+
+func ReadPGN(r io.Reader) ([]*Game, error) {
+	games := []*Game(nil)
+	pgn := NewPGNReader(r)
+
+	for {
+		game, err := pgn.Next()
+		if errors.Is(err, io.EOF) {
+			return games, nil
+		} else if err != nil {
+			return games, err
+		}
+
+		games = append(games, game)
+	}
+}
+
+// Next reads the next game, returning io.EOF once the input is exhausted.
+func (r *PGNReader) Next() (*Game, error) {
+	tags := []PGNTag(nil)
+	r.movetext = false
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.kind != pgnTokenTagOpen {
+			r.unread = &tok
+			break
+		}
+
+		tag, err := r.tag()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	r.movetext = true
+
+	if tok, err := r.peek(); err != nil {
+		return nil, err
+	} else if tok.kind == pgnTokenEOF && len(tags) == 0 {
+		return nil, io.EOF
+	}
+
+	fen := BoardStartPos
+
+	for _, tag := range tags {
+		if tag.Name == "FEN" {
+			fen = tag.Value
+		}
+	}
+
+	game, err := GameFromFEN(fen)
+	if err != nil {
+		return nil, r.errorf("invalid FEN tag: %w", err)
+	}
+
+	game.Tags = tags
+	game.Result = PGNResultUnknown
+
+	if result, ok := game.Tag("Result"); ok {
+		game.Result = result
+	}
+
+	mainline, result, err := r.variation(game, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if result != "" {
+		game.Result = result
+	}
+
+	game.Comment = mainline.Comment
+
+	for i, move := range mainline.Moves {
+		game.annotations[i] = move.PGNAnnotation
+	}
+
+	return game, nil
+}
+
+// Skip discards the rest of a game Next failed to read, so reading can carry
+// on with the game after it. Errors in the skipped text are ignored.
+func (r *PGNReader) Skip() error {
+	movetext := r.movetext
+	tag := false
+
+	for {
+		tok, err := r.next()
+		if errors.Is(err, ErrInvalidPGN) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		switch tok.kind {
+		case pgnTokenEOF:
+			return nil
+
+		case pgnTokenTagOpen:
+			// the next game starts with the first tag after some movetext
+			if movetext {
+				r.unread = &tok
+				return nil
+			}
+
+			tag = true
+
+		case pgnTokenTagClose:
+			tag = false
+
+		default:
+			movetext = movetext || !tag
+		}
+	}
+}
+
+func (r *PGNReader) tag() (PGNTag, error) {
+	name, err := r.expect(pgnTokenSymbol)
+	if err != nil {
+		return PGNTag{}, err
+	}
+
+	value, err := r.expect(pgnTokenString)
+	if err != nil {
+		return PGNTag{}, err
+	}
+
+	if _, err := r.expect(pgnTokenTagClose); err != nil {
+		return PGNTag{}, err
+	}
+
+	return PGNTag{Name: name.text, Value: value.text}, nil
+}
+
+// variation reads movetext, playing moves on the game as it goes. The
+// mainline stops at a result, the next game's tags or the end of the input,
+// variations stop at their closing parenthesis.
+func (r *PGNReader) variation(game *Game, mainline bool) (PGNVariation, string, error) {
+	variation := PGNVariation{}
+
+	last := func() *PGNMove {
+		if len(variation.Moves) == 0 {
+			return nil
+		}
+
+		return &variation.Moves[len(variation.Moves)-1]
+	}
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return variation, "", err
+		}
+
+		switch tok.kind {
+		case pgnTokenEOF:
+			if !mainline {
+				return variation, "", r.errorf("unterminated variation")
+			}
+
+			return variation, "", nil
+
+		case pgnTokenTagOpen:
+			if !mainline {
+				return variation, "", r.errorf("unterminated variation")
+			}
+
+			r.unread = &tok
+
+			return variation, "", nil
+
+		case pgnTokenVariationClose:
+			if mainline {
+				return variation, "", r.errorf("unexpected ')'")
+			}
+
+			return variation, "", nil
+
+		case pgnTokenComment:
+			if move := last(); move != nil {
+				move.Comment = joinPGNComment(move.Comment, tok.text)
+			} else {
+				variation.Comment = joinPGNComment(variation.Comment, tok.text)
+			}
+
+		case pgnTokenNAG:
+			move := last()
+			if move == nil {
+				return variation, "", r.errorf("annotation before first move: %s", tok.text)
+			}
+
+			nag, ok := pgnSuffixes[tok.text]
+			if !ok {
+				if nag, err = strconv.Atoi(tok.text[1:]); err != nil {
+					return variation, "", r.errorf("invalid annotation: %s", tok.text)
+				}
+			}
+
+			move.NAGs = append(move.NAGs, nag)
+
+		case pgnTokenVariationOpen:
+			move := last()
+			if move == nil {
+				return variation, "", r.errorf("variation before first move")
+			}
+
+			// a variation replaces the move before it
+			alt := game.Clone()
+			alt.UnmakeMove()
+
+			sub, _, err := r.variation(alt, false)
+			if err != nil {
+				return variation, "", err
+			}
+
+			move.Variations = append(move.Variations, sub)
+
+		case pgnTokenPeriod:
+
+		case pgnTokenSymbol:
+			switch tok.text {
+			case PGNResultWhite, PGNResultBlack, PGNResultDraw, PGNResultUnknown:
+				if !mainline {
+					return variation, "", r.errorf("result inside variation: %s", tok.text)
+				}
+
+				return variation, tok.text, nil
+			}
+
+			if strings.IndexFunc(tok.text, func(c rune) bool { return !unicode.IsDigit(c) }) == -1 {
+				continue // move number
+			}
+
+			move, err := ParseSAN(game.Board(), tok.text)
+			if err != nil {
+				return variation, "", r.errorf("%w", err)
+			}
+
+			game.Play(move, PGNAnnotation{})
+
+			variation.Moves = append(variation.Moves, PGNMove{
+				Move: move,
+				SAN:  tok.text,
+			})
+
+		default:
+			return variation, "", r.errorf("unexpected token: %q", tok.text)
+		}
+	}
+}
+
+func (r *PGNReader) expect(kind pgnTokenKind) (pgnToken, error) {
+	tok, err := r.next()
+	if err != nil {
+		return tok, err
+	}
+
+	if tok.kind != kind {
+		return tok, r.errorf("unexpected token: %q", tok.text)
+	}
+
+	return tok, nil
+}
+
+func (r *PGNReader) peek() (pgnToken, error) {
+	tok, err := r.next()
+	if err != nil {
+		return tok, err
+	}
+
+	r.unread = &tok
+
+	return tok, nil
+}
+
+func (r *PGNReader) next() (pgnToken, error) {
+	if tok := r.unread; tok != nil {
+		r.unread = nil
+		return *tok, nil
+	}
+
+	for {
+		c, err := r.read()
+		if errors.Is(err, io.EOF) {
+			return pgnToken{kind: pgnTokenEOF}, nil
+		} else if err != nil {
+			return pgnToken{}, err
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+			continue
+
+		case c == '%':
+			// escaped lines are ignored entirely
+			if _, err := r.until('\n'); err != nil {
+				return pgnToken{}, err
+			}
+
+		case c == ';':
+			text, err := r.until('\n')
+			if err != nil {
+				return pgnToken{}, err
+			}
+
+			return pgnToken{kind: pgnTokenComment, text: strings.TrimSpace(text)}, nil
+
+		case c == '{':
+			line := r.line
+
+			text, err := r.until('}')
+			if errors.Is(err, io.EOF) {
+				return pgnToken{}, fmt.Errorf("%w: line %d: unterminated comment", ErrInvalidPGN, line)
+			} else if err != nil {
+				return pgnToken{}, err
+			}
+
+			return pgnToken{kind: pgnTokenComment, text: strings.Join(strings.Fields(text), " ")}, nil
+
+		case c == '"':
+			return r.string()
+
+		case c == '$':
+			text, err := r.symbol(c, unicode.IsDigit)
+			if err != nil {
+				return pgnToken{}, err
+			}
+
+			return pgnToken{kind: pgnTokenNAG, text: text}, nil
+
+		case c == '!' || c == '?':
+			text, err := r.symbol(c, func(c rune) bool { return c == '!' || c == '?' })
+			if err != nil {
+				return pgnToken{}, err
+			}
+
+			return pgnToken{kind: pgnTokenNAG, text: text}, nil
+
+		case c == '.':
+			return pgnToken{kind: pgnTokenPeriod, text: "."}, nil
+
+		case c == '*':
+			return pgnToken{kind: pgnTokenSymbol, text: PGNResultUnknown}, nil
+
+		case c == '[':
+			return pgnToken{kind: pgnTokenTagOpen, text: "["}, nil
+
+		case c == ']':
+			return pgnToken{kind: pgnTokenTagClose, text: "]"}, nil
+
+		case c == '(':
+			return pgnToken{kind: pgnTokenVariationOpen, text: "("}, nil
+
+		case c == ')':
+			return pgnToken{kind: pgnTokenVariationClose, text: ")"}, nil
+
+		case isPGNSymbol(c):
+			text, err := r.symbol(c, isPGNSymbol)
+			if err != nil {
+				return pgnToken{}, err
+			}
+
+			return pgnToken{kind: pgnTokenSymbol, text: text}, nil
+
+		default:
+			return pgnToken{}, r.errorf("unexpected character: %q", c)
+		}
+	}
+}
+
+func (r *PGNReader) read() (rune, error) {
+	c, _, err := r.r.ReadRune()
+	if c == '\n' {
+		r.line++
+	}
+
+	return c, err
+}
+
+func (r *PGNReader) until(end rune) (string, error) {
+	s := strings.Builder{}
+
+	for {
+		c, err := r.read()
+		if err != nil {
+			// a line comment may end the input
+			if errors.Is(err, io.EOF) && end == '\n' {
+				return s.String(), nil
+			}
+
+			return s.String(), err
+		}
+
+		if c == end {
+			return s.String(), nil
+		}
+
+		s.WriteRune(c)
+	}
+}
+
+func (r *PGNReader) symbol(first rune, valid func(rune) bool) (string, error) {
+	s := strings.Builder{}
+	s.WriteRune(first)
+
+	for {
+		c, _, err := r.r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return s.String(), nil
+		} else if err != nil {
+			return s.String(), err
+		}
+
+		if !valid(c) {
+			return s.String(), r.r.UnreadRune()
+		}
+
+		s.WriteRune(c)
+	}
+}
+
+func (r *PGNReader) string() (pgnToken, error) {
+	s := strings.Builder{}
+	line := r.line
+
+	for {
+		c, err := r.read()
+		if errors.Is(err, io.EOF) {
+			return pgnToken{}, fmt.Errorf("%w: line %d: unterminated string", ErrInvalidPGN, line)
+		} else if err != nil {
+			return pgnToken{}, err
+		}
+
+		switch c {
+		case '"':
+			return pgnToken{kind: pgnTokenString, text: s.String()}, nil
+
+		case '\\':
+			if c, err = r.read(); err != nil {
+				return pgnToken{}, fmt.Errorf("%w: line %d: unterminated string", ErrInvalidPGN, line)
+			}
+		}
+
+		s.WriteRune(c)
+	}
+}
+
+func (r *PGNReader) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: line %d: %w", ErrInvalidPGN, r.line, fmt.Errorf(format, args...))
+}
+
+func isPGNSymbol(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_+#=:-/", c))
+}
+
+func joinPGNComment(comment, text string) string {
+	if comment == "" {
+		return text
+	}
+
+	return comment + " " + text
+}
+
+func WritePGN(w io.Writer, game *Game) error {
+	result := game.Result
+	if result == "" {
+		result = PGNResultUnknown
+	}
+
+	start := game.Start()
+
+	tags := []PGNTag(nil)
+
+	for _, tag := range PGNSevenTagRoster {
+		if value, ok := game.Tag(tag.Name); ok {
+			tag.Value = value
+		}
+
+		if tag.Name == "Result" {
+			tag.Value = result
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if fen := start.FEN(); fen != BoardStartPos {
+		tags = append(tags, PGNTag{"SetUp", "1"}, PGNTag{"FEN", fen})
+	}
+
+	for _, tag := range game.Tags {
+		switch tag.Name {
+		case "Event", "Site", "Date", "Round", "White", "Black", "Result", "SetUp", "FEN":
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	out := bufio.NewWriter(w)
+
+	for _, tag := range tags {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag.Value)
+
+		fmt.Fprintf(out, "[%s \"%s\"]\n", tag.Name, value)
+	}
+
+	out.WriteByte('\n')
+
+	mainline := PGNVariation{Comment: game.Comment}
+
+	for i, uci := range game.Moves() {
+		move, err := ParseUCIMove(start.Board(), uci)
+		if err != nil {
+			return fmt.Errorf("failed to replay game: %w", err)
+		}
+
+		annotation := PGNAnnotation{}
+		if i < len(game.annotations) {
+			annotation = game.annotations[i]
+		}
+
+		mainline.Moves = append(mainline.Moves, PGNMove{Move: move, PGNAnnotation: annotation})
+
+		start.MakeMove(move)
+	}
+
+	for range mainline.Moves {
+		start.UnmakeMove()
+	}
+
+	tokens := appendPGNVariation(nil, *start.Board(), mainline)
+	tokens = append(tokens, result)
+
+	length := 0
+
+	for _, tok := range tokens {
+		if length > 0 && length+1+len(tok) > PGNLineLength {
+			out.WriteByte('\n')
+			length = 0
+		} else if length > 0 {
+			out.WriteByte(' ')
+			length++
+		}
+
+		out.WriteString(tok)
+		length += len(tok)
+	}
+
+	out.WriteString("\n\n")
+
+	return out.Flush()
+}
+
+func appendPGNVariation(tokens []string, b Board, variation PGNVariation) []string {
+	if variation.Comment != "" {
+		tokens = appendPGNComment(tokens, variation.Comment)
+	}
+
+	number := true
+
+	for _, move := range variation.Moves {
+		if b.Player == White {
+			tokens = append(tokens, strconv.Itoa(b.Moves.Full)+".")
+		} else if number {
+			tokens = append(tokens, strconv.Itoa(b.Moves.Full)+"...")
+		}
+
+		tokens = append(tokens, FormatSAN(&b, move.Move))
+
+		for _, nag := range move.NAGs {
+			tokens = append(tokens, "$"+strconv.Itoa(nag))
+		}
+
+		if move.Comment != "" {
+			tokens = appendPGNComment(tokens, move.Comment)
+		}
+
+		// black's move needs its number repeated after any interruption
+		number = move.Comment != "" || len(move.Variations) > 0
+
+		for _, sub := range move.Variations {
+			n := len(tokens)
+
+			tokens = appendPGNVariation(tokens, b, sub)
+
+			if len(tokens) == n {
+				tokens = append(tokens, "()")
+			} else {
+				tokens[n] = "(" + tokens[n]
+				tokens[len(tokens)-1] += ")"
+			}
+		}
+
+		b.Make(move.Move)
+	}
+
+	return tokens
+}
+
+func appendPGNComment(tokens []string, comment string) []string {
+	words := strings.Fields(comment)
+
+	if len(words) == 0 {
+		return append(tokens, "{}")
+	}
+
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+
+	return append(tokens, words...)
+}
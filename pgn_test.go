@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPGN = `[Event "Casual \"Blitz\" game"]
+[Site "https://lichess.org/abcdefgh"]
+[Date "2024.01.02"]
+[Round "-"]
+[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]
+[WhiteElo "2000"]
+
+{Opening comment} 1. e4 e5 2. Nf3 $1 {Good} (2. Bc4 Nf6 (2... Bc5 3. Qh5) 3. d3)
+2... Nc6 3. Bb5!? a6 ; line comment
+4. Ba4 1-0
+
+% escaped line
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+[Result "*"]
+
+1. e4 Kd7 2. e5?? *
+
+1. d4 d5 1/2-1/2
+`
+
+func TestReadPGN(t *testing.T) {
+	games, err := ReadPGN(strings.NewReader(testPGN))
+	require.NoError(t, err)
+	require.Len(t, games, 3)
+
+	game := games[0]
+
+	assert.Equal(t, PGNResultWhite, game.Result)
+	assert.Equal(t, "Opening comment", game.Comment)
+	assert.Equal(t, []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1b5", "a7a6", "b5a4"}, game.Moves())
+
+	event, ok := game.Tag("Event")
+	assert.True(t, ok)
+	assert.Equal(t, `Casual "Blitz" game`, event)
+
+	annotations := game.Annotations()
+	require.Len(t, annotations, 7)
+
+	assert.Equal(t, []int{1}, annotations[2].NAGs)
+	assert.Equal(t, "Good", annotations[2].Comment)
+	assert.Equal(t, []int{5}, annotations[4].NAGs)
+	assert.Equal(t, "line comment", annotations[5].Comment)
+
+	require.Len(t, annotations[2].Variations, 1)
+
+	variation := annotations[2].Variations[0]
+	require.Len(t, variation.Moves, 3)
+
+	assert.Equal(t, "f1c4", variation.Moves[0].Move.String())
+	require.Len(t, variation.Moves[1].Variations, 1)
+	assert.Equal(t, "Bc5", variation.Moves[1].Variations[0].Moves[0].SAN)
+
+	game = games[1]
+
+	assert.Equal(t, PGNResultUnknown, game.Result)
+	assert.Equal(t, "8/3k4/8/4P3/8/8/8/4K3 b - - 0 2", game.FEN())
+	assert.Equal(t, []int{4}, game.Annotations()[2].NAGs)
+
+	game = games[2]
+
+	assert.Equal(t, PGNResultDraw, game.Result)
+	assert.Empty(t, game.Tags)
+	assert.Equal(t, []string{"d2d4", "d7d5"}, game.Moves())
+}
+
+func TestWritePGN(t *testing.T) {
+	games, err := ReadPGN(strings.NewReader(testPGN))
+	require.NoError(t, err)
+
+	out := bytes.Buffer{}
+	require.NoError(t, WritePGN(&out, games[0]))
+
+	expected := `[Event "Casual \"Blitz\" game"]
+[Site "https://lichess.org/abcdefgh"]
+[Date "2024.01.02"]
+[Round "-"]
+[White "Alice"]
+[Black "Bob"]
+[Result "1-0"]
+[WhiteElo "2000"]
+
+{Opening comment} 1. e4 e5 2. Nf3 $1 {Good} (2. Bc4 Nf6 (2... Bc5 3. Qh5) 3. d3)
+2... Nc6 3. Bb5 $5 a6 {line comment} 4. Ba4 1-0
+
+`
+
+	assert.Equal(t, expected, out.String())
+}
+
+func TestWritePGNSevenTagRoster(t *testing.T) {
+	game, err := GameFromFEN(BoardStartPos)
+	require.NoError(t, err)
+
+	require.NoError(t, game.MakeUCIMove("e2e4"))
+
+	out := bytes.Buffer{}
+	require.NoError(t, WritePGN(&out, game))
+
+	expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+
+1. e4 *
+
+`
+
+	assert.Equal(t, expected, out.String())
+}
+
+func TestPGNRoundTrip(t *testing.T) {
+	games, err := ReadPGN(strings.NewReader(testPGN))
+	require.NoError(t, err)
+
+	out := bytes.Buffer{}
+
+	for _, game := range games {
+		require.NoError(t, WritePGN(&out, game))
+	}
+
+	again, err := ReadPGN(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, again, len(games))
+
+	for i, game := range games {
+		assert.Equal(t, game.FEN(), again[i].FEN())
+		assert.Equal(t, game.Moves(), again[i].Moves())
+		assert.Equal(t, game.Result, again[i].Result)
+		assert.Equal(t, game.Comment, again[i].Comment)
+
+		for j, annotation := range game.Annotations() {
+			assert.Equal(t, annotation.Comment, again[i].Annotations()[j].Comment)
+			assert.Equal(t, annotation.NAGs, again[i].Annotations()[j].NAGs)
+			assert.Equal(t, len(annotation.Variations), len(again[i].Annotations()[j].Variations))
+		}
+	}
+}
+
+func TestReadPGNInvalid(t *testing.T) {
+	tests := map[string]string{
+		"illegal move":           "1. e5 *",
+		"unterminated comment":   "1. e4 {comment *",
+		"unterminated string":    "[Event \"x]\n\n1. e4 *",
+		"unterminated variation": "1. e4 (1. d4 *",
+		"unexpected paren":       "1. e4 ) *",
+		"variation first":        "(1. d4) 1. e4 *",
+		"invalid fen":            "[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n\n*",
+		"bad tag":                "[Event]\n\n*",
+	}
+
+	for name, pgn := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadPGN(strings.NewReader(pgn))
+			assert.ErrorIs(t, err, ErrInvalidPGN)
+		})
+	}
+}
+
+func TestPGNReaderSkip(t *testing.T) {
+	tests := map[string]string{
+		"illegal move": "[Event \"a\"]\n\n1. e4 e5 2. Qxe5 (2. Nf3) 1-0\n\n",
+		"bad tag":      "[Event]\n[Site \"b\"]\n\n1. d4 *\n\n",
+		"invalid fen":  "[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n[Site \"b\"]\n\n*\n\n",
+	}
+
+	for name, bad := range tests {
+		t.Run(name, func(t *testing.T) {
+			pgn := NewPGNReader(strings.NewReader(bad + "[Event \"next\"]\n\n1. c4 *\n"))
+
+			_, err := pgn.Next()
+			require.ErrorIs(t, err, ErrInvalidPGN)
+			require.NoError(t, pgn.Skip())
+
+			game, err := pgn.Next()
+			require.NoError(t, err)
+
+			event, _ := game.Tag("Event")
+			assert.Equal(t, "next", event)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+type MovePickerStage uint8
+
+const (
+	MovePickerFirst MovePickerStage = iota
+	MovePickerGenerateNoisy
+	MovePickerNoisy
+	MovePickerKillers
+	MovePickerGenerateQuiets
+	MovePickerQuiets
+	MovePickerBadCaptures
+	MovePickerDone
+)
+
+const MovePickerCaptureScore = 100
+
+type MovePicker struct {
+	board      *Board
+	heuristics *SearchHeuristics
+	ply        int
+	first      Move
+	quiescence bool
+
+	stage   MovePickerStage
+	killers [3]Move
+	killer  int
+
+	moves  [256]Move
+	scores [256]int
+	count  int
+	index  int
+
+	bad      [256]Move
+	badCount int
+	badIndex int
+}
+
+func (p *MovePicker) Reset(b *Board, h *SearchHeuristics, ply int, first Move) {
+	p.board = b
+	p.heuristics = h
+	p.ply = ply
+	p.first = first
+	p.quiescence = false
+
+	p.stage = MovePickerFirst
+	p.killer = 0
+	p.count = 0
+	p.index = 0
+	p.badCount = 0
+	p.badIndex = 0
+
+	p.killers = [3]Move{h.Killers[ply][0], h.Killers[ply][1]}
+
+	if last := b.Moves.Last; !last.IsZero() {
+		p.killers[2] = h.Counters[last.From][last.To]
+	} else {
+		p.killers[2] = Move{}
+	}
+}
+
+func (p *MovePicker) ResetQuiescence(b *Board) {
+	p.board = b
+	p.heuristics = nil
+	p.first = Move{}
+	p.quiescence = true
+
+	p.stage = MovePickerGenerateNoisy
+	p.count = 0
+	p.index = 0
+	p.badCount = 0
+	p.badIndex = 0
+}
+
+func (p *MovePicker) Next() (Move, bool) {
+	for {
+		switch p.stage {
+		case MovePickerFirst:
+			p.stage = MovePickerGenerateNoisy
+
+			if !p.first.IsZero() && IsLegalMove(p.board, p.first) {
+				return p.first, true
+			}
+
+		case MovePickerGenerateNoisy:
+			p.stage = MovePickerNoisy
+
+			opts := MoveGenerationOptions{NoisyOnly: true}
+			if p.quiescence {
+				opts = MoveGenerationOptions{CapturesOnly: true}
+			}
+
+			p.count = len(AppendMoves(p.board, p.moves[:0], opts))
+			p.index = 0
+
+			// captures that don't lose material are tried before quiet
+			// promotions
+			for i, move := range p.moves[:p.count] {
+				if move.Flags&MoveFlagCapture != 0 {
+					p.scores[i] = MovePickerCaptureScore + ScoreCapture(p.board, move)
+				} else {
+					p.scores[i] = ScoreMove(p.board, move)
+				}
+			}
+
+		case MovePickerNoisy:
+			move, ok := p.pick()
+			if !ok {
+				if p.quiescence {
+					p.stage = MovePickerDone
+				} else {
+					p.stage = MovePickerKillers
+				}
+
+				continue
+			}
+
+			if move == p.first {
+				continue
+			}
+
+			if move.Flags&MoveFlagCapture != 0 && move.Flags&MoveFlagPromoteAny == 0 && SEE(p.board, move) < 0 {
+				p.bad[p.badCount] = move
+				p.badCount++
+				continue
+			}
+
+			return move, true
+
+		case MovePickerKillers:
+			if p.killer >= len(p.killers) {
+				p.stage = MovePickerGenerateQuiets
+				continue
+			}
+
+			move := p.killers[p.killer]
+			p.killer++
+
+			if move.IsZero() || move == p.first || move.Flags&(MoveFlagCapture|MoveFlagPromoteAny) != 0 {
+				continue
+			}
+
+			if p.isKiller(move, p.killer-1) {
+				continue
+			}
+
+			if !IsLegalMove(p.board, move) {
+				continue
+			}
+
+			return move, true
+
+		case MovePickerGenerateQuiets:
+			p.stage = MovePickerQuiets
+
+			p.count = len(AppendMoves(p.board, p.moves[:0], MoveGenerationOptions{QuietsOnly: true}))
+			p.index = 0
+
+			for i, move := range p.moves[:p.count] {
+				p.scores[i] = p.heuristics.History[p.board.Player][move.From][move.To]
+			}
+
+		case MovePickerQuiets:
+			move, ok := p.pick()
+			if !ok {
+				p.stage = MovePickerBadCaptures
+				continue
+			}
+
+			if move == p.first || p.isKiller(move, len(p.killers)) {
+				continue
+			}
+
+			return move, true
+
+		case MovePickerBadCaptures:
+			if p.badIndex >= p.badCount {
+				p.stage = MovePickerDone
+				continue
+			}
+
+			p.badIndex++
+
+			return p.bad[p.badIndex-1], true
+
+		case MovePickerDone:
+			return Move{}, false
+		}
+	}
+}
+
+func (p *MovePicker) Stage() MovePickerStage {
+	return p.stage
+}
+
+// pick selects the highest scoring remaining move, which is cheaper than
+// sorting when a cutoff happens after only a few moves.
+func (p *MovePicker) pick() (Move, bool) {
+	if p.index >= p.count {
+		return Move{}, false
+	}
+
+	best := p.index
+
+	for i := p.index + 1; i < p.count; i++ {
+		if p.scores[i] > p.scores[best] {
+			best = i
+		}
+	}
+
+	p.moves[p.index], p.moves[best] = p.moves[best], p.moves[p.index]
+	p.scores[p.index], p.scores[best] = p.scores[best], p.scores[p.index]
+
+	p.index++
+
+	return p.moves[p.index-1], true
+}
+
+func (p *MovePicker) isKiller(move Move, before int) bool {
+	for _, killer := range p.killers[:min(before, len(p.killers))] {
+		if killer == move {
+			return true
+		}
+	}
+
+	return false
+}
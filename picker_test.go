@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovePicker(t *testing.T) {
+	// after e7e6 the pawn on d5 is defended, so taking it loses material
+	game, err := GameFromFEN("4k3/1P2p3/8/3p4/n7/2N5/8/3QK3 b - - 0 1")
+	require.NoError(t, err)
+	require.NoError(t, game.MakeUCIMove("e7e6"))
+
+	b := game.Board()
+
+	h := &SearchHeuristics{}
+	h.Killers[3] = [2]Move{NewMove(SquareD1, SquareD3), NewMove(SquareH2, SquareH4)}
+	h.Counters[SquareE7][SquareE6] = NewMove(SquareE1, SquareF2)
+	h.History[White][SquareC3][SquareB5] = 100
+	h.History[White][SquareD1][SquareG4] = 50
+
+	pick := func(picker *MovePicker) ([]string, []MovePickerStage) {
+		moves, stages := []string(nil), []MovePickerStage(nil)
+
+		for {
+			move, ok := picker.Next()
+			if !ok {
+				return moves, stages
+			}
+
+			moves = append(moves, move.String())
+			stages = append(stages, picker.Stage())
+		}
+	}
+
+	t.Run("search", func(t *testing.T) {
+		picker := MovePicker{}
+		picker.Reset(b, h, 3, NewMove(SquareC3, SquareE4))
+
+		moves, stages := pick(&picker)
+
+		expected := []string{
+			// the hash move
+			"c3e4",
+			// good captures, least valuable attacker first, then promotions
+			"c3a4", "d1a4",
+			"b7b8q", "b7b8r", "b7b8b", "b7b8n",
+			// killers then the counter move, skipping the illegal killer
+			"d1d3", "e1f2",
+			// quiets with history first
+			"c3b5", "d1g4",
+		}
+
+		require.Greater(t, len(moves), len(expected)+2)
+		assert.Equal(t, expected, moves[:len(expected)])
+
+		// captures that lose material are deferred until everything else
+		assert.Equal(t, []string{"c3d5", "d1d5"}, moves[len(moves)-2:])
+
+		legal := []string(nil)
+		for _, move := range GenerateMoves(b, MoveGenerationOptions{}) {
+			legal = append(legal, move.String())
+		}
+
+		assert.ElementsMatch(t, legal, moves, "every legal move exactly once")
+		assert.IsNonDecreasing(t, stages)
+		assert.Equal(t, MovePickerBadCaptures, stages[len(stages)-1])
+		assert.Equal(t, MovePickerDone, picker.Stage())
+	})
+
+	t.Run("quiescence", func(t *testing.T) {
+		picker := MovePicker{}
+		picker.ResetQuiescence(b)
+
+		moves, _ := pick(&picker)
+
+		// quiet promotions aren't searched and losing captures are pruned
+		assert.Equal(t, []string{"c3a4", "d1a4"}, moves)
+	})
+}
+
+func TestMovePickerCaptureOrder(t *testing.T) {
+	picked := func(t *testing.T, fen string) []string {
+		b, err := BoardFromFEN(fen)
+		require.NoError(t, err)
+
+		picker := &MovePicker{}
+		picker.Reset(&b, &SearchHeuristics{}, 0, Move{})
+
+		moves := []string(nil)
+
+		for move, ok := picker.Next(); ok; move, ok = picker.Next() {
+			moves = append(moves, move.String())
+		}
+
+		return moves
+	}
+
+	// MVV-LVA prefers the rook capture, but it only trades rooks while the
+	// knight wins a bishop
+	moves := picked(t, "k7/8/4p3/3r2b1/8/5N2/8/3RK3 w - - 0 1")
+	assert.Equal(t, []string{"f3g5", "d1d5"}, moves[:2])
+
+	t.Run("losing captures last", func(t *testing.T) {
+		moves := picked(t, "k7/8/4p3/3n4/8/8/8/3RK3 w - - 0 1")
+		assert.Equal(t, "d1d5", moves[len(moves)-1])
+	})
+
+	t.Run("ties broken by MVV-LVA", func(t *testing.T) {
+		// both captures win a pawn, the pawn capture risks less
+		moves := picked(t, "k7/8/8/3p4/4P3/8/8/3RK3 w - - 0 1")
+		assert.Equal(t, []string{"e4d5", "d1d5"}, moves[:2])
+	})
+}
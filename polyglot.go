@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+)
+
+var ErrInvalidPolyglot = fmt.Errorf("invalid polyglot book")
+
+const (
+	polyglotCastling  = 768
+	polyglotEnPassant = 772
+	polyglotTurn      = 780
+
+	// PolyglotEntrySize is the size of a single big-endian book entry.
+	PolyglotEntrySize = 16
+)
+
+// PolyglotKey computes the Polyglot hash of a position. It is unrelated to
+// Board.Zobrist, which uses our own random numbers.
+func PolyglotKey(b *Board) uint64 {
+	key := uint64(0)
+
+	for sq := range Squares() {
+		piece := b.Squares[sq]
+		if piece == EmptySquare {
+			continue
+		}
+
+		// polyglot orders pieces as black pawn, white pawn, black knight...
+		kind := 2*int(piece.Type()-Pawn) + int(piece.Color())
+		key ^= PolyglotRandom64[64*kind+int(sq)]
+	}
+
+	if b.Castling[White].Kingside {
+		key ^= PolyglotRandom64[polyglotCastling]
+	}
+
+	if b.Castling[White].Queenside {
+		key ^= PolyglotRandom64[polyglotCastling+1]
+	}
+
+	if b.Castling[Black].Kingside {
+		key ^= PolyglotRandom64[polyglotCastling+2]
+	}
+
+	if b.Castling[Black].Queenside {
+		key ^= PolyglotRandom64[polyglotCastling+3]
+	}
+
+	if polyglotEnPassantCapturable(b) {
+		key ^= PolyglotRandom64[polyglotEnPassant+int(b.EnPassant.File())]
+	}
+
+	if b.Player == White {
+		key ^= PolyglotRandom64[polyglotTurn]
+	}
+
+	return key
+}
+
+// polyglot only hashes the en passant file when a pawn of the side to move
+// stands next to the pawn that just made a double push.
+func polyglotEnPassantCapturable(b *Board) bool {
+	if b.EnPassant == 0 {
+		return false
+	}
+
+	rank := Rank4
+	if b.Player == White {
+		rank = Rank5
+	}
+
+	pawn := NewPiece(b.Player, Pawn)
+	file := b.EnPassant.File()
+
+	if file > FileA && b.Squares[NewSquare(file-1, rank)] == pawn {
+		return true
+	}
+
+	return file < FileH && b.Squares[NewSquare(file+1, rank)] == pawn
+}
+
+type PolyglotEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// UCI decodes the entry's move for the given position. Polyglot encodes
+// castling as the king capturing its own rook, which is translated to the
+// king's destination square.
+func (e PolyglotEntry) UCI(b *Board) string {
+	to := NewSquare(File(e.Move&7), Rank(e.Move>>3&7))
+	from := NewSquare(File(e.Move>>6&7), Rank(e.Move>>9&7))
+
+	if b.Squares[from].Type() == King && from.File() == FileE {
+		switch to.File() {
+		case FileH:
+			to = NewSquare(FileG, to.Rank())
+
+		case FileA:
+			to = NewSquare(FileC, to.Rank())
+		}
+	}
+
+	s := from.String() + to.String()
+
+	if promotion := e.Move >> 12 & 7; promotion > 0 && promotion <= 4 {
+		s += " nbrq"[promotion : promotion+1]
+	}
+
+	return s
+}
+
+// PolyglotMove encodes a move the way polyglot books store it, with castling
+// as the king capturing its own rook.
+func PolyglotMove(move Move) uint16 {
+	to := move.To
+
+	switch {
+	case move.Flags&MoveFlagCastleKingside != 0:
+		to = NewSquare(FileH, to.Rank())
+
+	case move.Flags&MoveFlagCastleQueenside != 0:
+		to = NewSquare(FileA, to.Rank())
+	}
+
+	encoded := uint16(move.From.Rank())<<9 | uint16(move.From.File())<<6 | uint16(to.Rank())<<3 | uint16(to.File())
+
+	if promotion, ok := move.Promotion(); ok {
+		encoded |= uint16(slices.Index([]PieceType{Knight, Bishop, Rook, Queen}, promotion)+1) << 12
+	}
+
+	return encoded
+}
+
+type PolyglotBook struct {
+	entries []PolyglotEntry
+}
+
+func LoadPolyglotBook(path string) (*PolyglotBook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open polyglot book: %w", err)
+	}
+
+	defer file.Close()
+
+	return ReadPolyglotBook(file)
+}
+
+func ReadPolyglotBook(r io.Reader) (*PolyglotBook, error) {
+	book := &PolyglotBook{}
+	buf := [PolyglotEntrySize]byte{}
+
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: truncated entry %d", ErrInvalidPolyglot, len(book.entries))
+			}
+
+			return nil, err
+		}
+
+		book.entries = append(book.entries, PolyglotEntry{
+			Key:    binary.BigEndian.Uint64(buf[0:8]),
+			Move:   binary.BigEndian.Uint16(buf[8:10]),
+			Weight: binary.BigEndian.Uint16(buf[10:12]),
+			Learn:  binary.BigEndian.Uint32(buf[12:16]),
+		})
+	}
+
+	// books are meant to be sorted already, but don't rely on it
+	slices.SortStableFunc(book.entries, func(a, b PolyglotEntry) int {
+		switch {
+		case a.Key < b.Key:
+			return -1
+
+		case a.Key > b.Key:
+			return 1
+		}
+
+		return 0
+	})
+
+	return book, nil
+}
+
+// WritePolyglotBook writes entries sorted by key, and by descending weight
+// within a position, as polyglot expects.
+func WritePolyglotBook(w io.Writer, entries []PolyglotEntry) error {
+	entries = slices.Clone(entries)
+
+	slices.SortFunc(entries, func(a, b PolyglotEntry) int {
+		switch {
+		case a.Key < b.Key:
+			return -1
+
+		case a.Key > b.Key:
+			return 1
+		}
+
+		return int(b.Weight) - int(a.Weight)
+	})
+
+	buf := [PolyglotEntrySize]byte{}
+
+	for _, entry := range entries {
+		binary.BigEndian.PutUint64(buf[0:8], entry.Key)
+		binary.BigEndian.PutUint16(buf[8:10], entry.Move)
+		binary.BigEndian.PutUint16(buf[10:12], entry.Weight)
+		binary.BigEndian.PutUint32(buf[12:16], entry.Learn)
+
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pb *PolyglotBook) Len() int {
+	return len(pb.entries)
+}
+
+// Entries returns the book entries for a position, in file order.
+func (pb *PolyglotBook) Entries(b *Board) []PolyglotEntry {
+	key := PolyglotKey(b)
+
+	start, _ := slices.BinarySearchFunc(pb.entries, key, func(e PolyglotEntry, key uint64) int {
+		switch {
+		case e.Key < key:
+			return -1
+
+		case e.Key > key:
+			return 1
+		}
+
+		return 0
+	})
+
+	end := start
+	for end < len(pb.entries) && pb.entries[end].Key == key {
+		end++
+	}
+
+	return pb.entries[start:end]
+}
+
+// RandomMove picks a legal book move for the position with probability
+// proportional to its weight. Entries with no weight are never played.
+func (pb *PolyglotBook) RandomMove(b *Board, rng *rand.Rand) (Move, bool) {
+	moves := []Move(nil)
+	weights := []int(nil)
+	total := 0
+
+	for _, entry := range pb.Entries(b) {
+		if entry.Weight == 0 {
+			continue
+		}
+
+		move, err := ParseUCIMove(b, entry.UCI(b))
+		if err != nil {
+			continue
+		}
+
+		moves = append(moves, move)
+		weights = append(weights, int(entry.Weight))
+		total += int(entry.Weight)
+	}
+
+	if total == 0 {
+		return Move{}, false
+	}
+
+	n := rng.Intn(total)
+
+	for i, weight := range weights {
+		if n < weight {
+			return moves[i], true
+		}
+
+		n -= weight
+	}
+
+	return Move{}, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolyglotKey(t *testing.T) {
+	// test positions from the polyglot book format specification
+	tests := []struct {
+		moves []string
+		key   uint64
+	}{
+		{nil, 0x463b96181691fc9c},
+		{[]string{"e2e4"}, 0x823c9b50fd114196},
+		{[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+		{[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+		{[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+		{[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		game, err := GameFromFEN(BoardStartPos)
+		require.NoError(t, err)
+
+		for _, move := range test.moves {
+			require.NoError(t, game.MakeUCIMove(move))
+		}
+
+		assert.Equal(t, test.key, PolyglotKey(game.Board()), "after %v", test.moves)
+	}
+}
+
+func polyglotBookBytes(entries ...PolyglotEntry) []byte {
+	buf := bytes.Buffer{}
+
+	for _, e := range entries {
+		_ = binary.Write(&buf, binary.BigEndian, e)
+	}
+
+	return buf.Bytes()
+}
+
+func polyglotMove(from, to Square, promotion uint16) uint16 {
+	return promotion<<12 | uint16(from.Rank())<<9 | uint16(from.File())<<6 | uint16(to.Rank())<<3 | uint16(to.File())
+}
+
+func TestPolyglotBook(t *testing.T) {
+	start, err := BoardFromFEN(BoardStartPos)
+	require.NoError(t, err)
+
+	castle, err := BoardFromFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	require.NoError(t, err)
+
+	promote, err := BoardFromFEN("8/P6k/8/8/8/8/8/K7 w - - 0 1")
+	require.NoError(t, err)
+
+	data := polyglotBookBytes(
+		PolyglotEntry{Key: PolyglotKey(&promote), Move: polyglotMove(SquareA7, SquareA8, 4), Weight: 1},
+		PolyglotEntry{Key: PolyglotKey(&start), Move: polyglotMove(SquareE2, SquareE4, 0), Weight: 3},
+		PolyglotEntry{Key: PolyglotKey(&start), Move: polyglotMove(SquareD2, SquareD4, 0), Weight: 1},
+		PolyglotEntry{Key: PolyglotKey(&start), Move: polyglotMove(SquareG1, SquareF3, 0), Weight: 0},
+		PolyglotEntry{Key: PolyglotKey(&castle), Move: polyglotMove(SquareE1, SquareH1, 0), Weight: 1},
+		PolyglotEntry{Key: PolyglotKey(&castle), Move: polyglotMove(SquareE1, SquareA1, 0), Weight: 1},
+	)
+
+	book, err := ReadPolyglotBook(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 6, book.Len())
+
+	moves := func(b *Board) []string {
+		s := []string(nil)
+
+		for _, entry := range book.Entries(b) {
+			s = append(s, entry.UCI(b))
+		}
+
+		return s
+	}
+
+	assert.Equal(t, []string{"e2e4", "d2d4", "g1f3"}, moves(&start))
+	assert.Equal(t, []string{"e1g1", "e1c1"}, moves(&castle))
+	assert.Equal(t, []string{"a7a8q"}, moves(&promote))
+
+	rng := rand.New(rand.NewSource(1))
+	seen := map[string]int{}
+
+	for range 1000 {
+		move, ok := book.RandomMove(&start, rng)
+		require.True(t, ok)
+
+		seen[move.String()]++
+	}
+
+	assert.Len(t, seen, 2, "moves without weight are never played")
+	assert.Greater(t, seen["e2e4"], seen["d2d4"])
+
+	move, ok := book.RandomMove(&castle, rng)
+	require.True(t, ok)
+	assert.NotZero(t, move.Flags&(MoveFlagCastleKingside|MoveFlagCastleQueenside))
+
+	empty, err := BoardFromFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	require.NoError(t, err)
+
+	_, ok = book.RandomMove(&empty, rng)
+	assert.False(t, ok)
+}
+
+func TestReadPolyglotBookTruncated(t *testing.T) {
+	data := polyglotBookBytes(PolyglotEntry{Key: 1, Move: 2, Weight: 3})
+
+	_, err := ReadPolyglotBook(bytes.NewReader(data[:PolyglotEntrySize-1]))
+	assert.ErrorIs(t, err, ErrInvalidPolyglot)
+}
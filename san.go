@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func FormatSAN(b *Board, m Move) string {
+	s := strings.Builder{}
+
+	piece := b.Squares[m.From].Type()
+
+	switch {
+	case m.Flags&MoveFlagCastleKingside != 0:
+		s.WriteString("O-O")
+
+	case m.Flags&MoveFlagCastleQueenside != 0:
+		s.WriteString("O-O-O")
+
+	default:
+		if piece == Pawn {
+			if m.Flags&MoveFlagCapture != 0 {
+				s.WriteString(m.From.File().String())
+			}
+		} else {
+			s.WriteString(strings.ToUpper(piece.String()))
+			s.WriteString(disambiguateSAN(b, m))
+		}
+
+		if m.Flags&MoveFlagCapture != 0 {
+			s.WriteByte('x')
+		}
+
+		s.WriteString(m.To.String())
+
+		if promotion, ok := m.Promotion(); ok {
+			s.WriteByte('=')
+			s.WriteString(strings.ToUpper(promotion.String()))
+		}
+	}
+
+	next := b.MakeMove(m)
+
+	if next.Attacks.Checks > 0 {
+		if len(GenerateMoves(&next, MoveGenerationOptions{})) == 0 {
+			s.WriteByte('#')
+		} else {
+			s.WriteByte('+')
+		}
+	}
+
+	return s.String()
+}
+
+func disambiguateSAN(b *Board, m Move) string {
+	piece := b.Squares[m.From]
+
+	ambiguous, file, rank := false, false, false
+
+	for _, other := range GenerateMoves(b, MoveGenerationOptions{From: b.Bits.Pieces[piece.Type()]}) {
+		if other.To != m.To || other.From == m.From {
+			continue
+		}
+
+		ambiguous = true
+
+		if other.From.File() == m.From.File() {
+			file = true
+		}
+
+		if other.From.Rank() == m.From.Rank() {
+			rank = true
+		}
+	}
+
+	switch {
+	case !ambiguous:
+		return ""
+
+	case !file:
+		return m.From.File().String()
+
+	case !rank:
+		return m.From.Rank().String()
+
+	default:
+		return m.From.String()
+	}
+}
+
+func ParseSAN(b *Board, s string) (Move, error) {
+	san := strings.TrimRight(s, "+#!?")
+
+	switch san {
+	case "O-O", "0-0":
+		return parseSANCastling(b, s, MoveFlagCastleKingside)
+
+	case "O-O-O", "0-0-0":
+		return parseSANCastling(b, s, MoveFlagCastleQueenside)
+	}
+
+	piece := Pawn
+
+	if len(san) > 0 {
+		switch san[0] {
+		case 'N':
+			piece = Knight
+
+		case 'B':
+			piece = Bishop
+
+		case 'R':
+			piece = Rook
+
+		case 'Q':
+			piece = Queen
+
+		case 'K':
+			piece = King
+		}
+
+		if piece != Pawn {
+			san = san[1:]
+		}
+	}
+
+	promotion := PieceType(0)
+
+	// promotions may be written as e8=Q, e8Q or e8q
+	if n := len(san); n >= 3 && (san[n-2] == '=' || san[n-2] >= '1' && san[n-2] <= '8') {
+		p, ok := PieceFromString(strings.ToLower(san[n-1:]))
+		if ok && (p.Type() == Pawn || p.Type() == King) {
+			return Move{}, fmt.Errorf("%w: invalid promotion: %q", ErrInvalidMove, s)
+		}
+
+		if ok {
+			promotion = p.Type()
+			san = strings.TrimSuffix(san[:n-1], "=")
+		}
+	}
+
+	if len(san) < 2 {
+		return Move{}, fmt.Errorf("%w: missing target square: %q", ErrInvalidMove, s)
+	}
+
+	to, ok := SquareFromString(san[len(san)-2:])
+	if !ok {
+		return Move{}, fmt.Errorf("%w: invalid target square: %q", ErrInvalidMove, s)
+	}
+
+	from := strings.TrimSuffix(san[:len(san)-2], "x")
+	if len(from) > 2 {
+		return Move{}, fmt.Errorf("%w: invalid source square: %q", ErrInvalidMove, s)
+	}
+
+	mask := b.Bits.Pieces[piece]
+
+	for _, c := range from {
+		if file, ok := FileFromString(string(c)); ok {
+			mask = mask.And(BitboardForFile(file))
+		} else if rank, ok := RankFromString(string(c)); ok {
+			mask = mask.And(BitboardForRank(rank))
+		} else {
+			return Move{}, fmt.Errorf("%w: invalid source square: %q", ErrInvalidMove, s)
+		}
+	}
+
+	// an empty mask would generate moves for every piece
+	if mask == 0 {
+		return Move{}, fmt.Errorf("%w: illegal in position %s: %s", ErrInvalidMove, b.FEN(), s)
+	}
+
+	matches := 0
+	move := Move{}
+
+	for _, m := range GenerateMoves(b, MoveGenerationOptions{From: mask}) {
+		if p, _ := m.Promotion(); m.To != to || p != promotion {
+			continue
+		}
+
+		matches++
+		move = m
+	}
+
+	switch matches {
+	case 0:
+		return Move{}, fmt.Errorf("%w: illegal in position %s: %s", ErrInvalidMove, b.FEN(), s)
+
+	case 1:
+		return move, nil
+
+	default:
+		return Move{}, fmt.Errorf("%w: ambiguous in position %s: %s", ErrInvalidMove, b.FEN(), s)
+	}
+}
+
+func parseSANCastling(b *Board, s string, flag MoveFlags) (Move, error) {
+	for _, m := range GenerateMoves(b, MoveGenerationOptions{From: b.Kings[b.Player].Bitboard()}) {
+		if m.Flags&flag != 0 {
+			return m, nil
+		}
+	}
+
+	return Move{}, fmt.Errorf("%w: illegal in position %s: %s", ErrInvalidMove, b.FEN(), s)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSAN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected string
+	}{
+		{BoardStartPos, "e2e4", "e4"},
+		{BoardStartPos, "g1f3", "Nf3"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+		{"3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8q", "exd8=Q+"},
+		{"3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8n", "e8=N"},
+		{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "f1d1", "Rfd1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+		{"7k/2N5/8/8/8/2N1N3/8/4K3 w - - 0 1", "c3d5", "Nc3d5"},
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8#"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			b, err := BoardFromFEN(test.fen)
+			require.NoError(t, err)
+
+			move, err := ParseUCIMove(&b, test.move)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, FormatSAN(&b, move))
+		})
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		expected string
+	}{
+		{BoardStartPos, "e4", "e2e4"},
+		{BoardStartPos, "Nf3", "g1f3"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O-O", "e8c8"},
+		{"3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1", "exd8=Q", "e7d8q"},
+		{"3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1", "exd8Q+", "e7d8q"},
+		{"3r3k/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8n", "e7e8n"},
+		{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "Rad1", "a1d1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "R1a3", "a1a3"},
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "Ra8", "a1a8"},
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "Ra8#!", "a1a8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.san, func(t *testing.T) {
+			b, err := BoardFromFEN(test.fen)
+			require.NoError(t, err)
+
+			move, err := ParseSAN(&b, test.san)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, move.String())
+		})
+	}
+}
+
+func TestParseSANInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":     "",
+		"illegal":   "e5",
+		"ambiguous": "Nd2",
+		"no piece":  "Qd1",
+		"castling":  "O-O-O",
+		"promotion": "a8=K",
+		"garbage":   "Nxyz3",
+	}
+
+	b, err := BoardFromFEN("4k3/P7/8/8/8/8/4P3/RN2KN1R w K - 0 1")
+	require.NoError(t, err)
+
+	for name, san := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSAN(&b, san)
+			assert.ErrorIs(t, err, ErrInvalidMove)
+		})
+	}
+}
+
+func TestSANRoundTrip(t *testing.T) {
+	tests := loadPerftPositions(t)
+
+	for fen := range tests {
+		t.Run(fen, func(t *testing.T) {
+			game, err := GameFromFEN(fen)
+			require.NoError(t, err)
+
+			var walk func(depth int)
+
+			walk = func(depth int) {
+				if depth == 0 {
+					return
+				}
+
+				for _, move := range GenerateMoves(game.Board(), MoveGenerationOptions{}) {
+					san := FormatSAN(game.Board(), move)
+
+					parsed, err := ParseSAN(game.Board(), san)
+					require.NoError(t, err, "%s in %s", san, game.FEN())
+					require.Equal(t, move, parsed, "%s in %s", san, game.FEN())
+
+					game.MakeMove(move)
+					walk(depth - 1)
+					game.UnmakeMove()
+				}
+			}
+
+			walk(2)
+		})
+	}
+}
@@ -31,9 +31,10 @@ cd ../..
 
 export CHESTER_DEFAULT_MOVE_TIME=${CHESTER_DEFAULT_MOVE_TIME:-200ms}
 
+# per-engine uci options, e.g. NEW_OPTIONS="option.NullMovePruning=false"
 cutechess-cli \
-  -engine name=old cmd=tmp/bin/old proto=uci \
-  -engine name=new cmd=tmp/bin/new proto=uci \
+  -engine name=old cmd=tmp/bin/old proto=uci $OLD_OPTIONS \
+  -engine name=new cmd=tmp/bin/new proto=uci $NEW_OPTIONS \
   -concurrency ${CONCURRENCY:-1} \
   -each tc=${TC:-60+1} \
   -rounds ${ROUNDS:-10} \
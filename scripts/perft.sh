@@ -15,16 +15,14 @@ if [ "$position" == "startpos" ]; then
   position="rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 fi
 
-command="position fen $position"
+args=(--log-level=ERROR perft --depth="$depth" --fen="$position" --divide)
 
 if [ -n "$moves" ]; then
-  command="$command moves $moves"
+  args+=(--moves="${moves// /,}")
 fi
 
-command="$command\ngo perft $depth"
-
-chester=$(echo -e $command | go run . uci | grep .)
-chester_nodes=$(echo "$chester" | grep 'nodes:' | awk '{print $2}')
-chester_moves=$(echo "$chester" | grep -v 'nodes:' | sed 's/^ //' | sed 's/://')
+chester=$(go run . "${args[@]}" | grep .)
+chester_nodes=$(echo "$chester" | grep '^nodes' | awk '{print $2}')
+chester_moves=$(echo "$chester" | grep ':' | sed 's/^ *//' | sed 's/://')
 
 echo -e "$chester_moves\n\n$chester_nodes"
@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,39 +17,153 @@ type SearchContext struct {
 	TT   *TranspositionTable
 
 	Best Move
+	Eval Eval
+	PV   []Move
 
 	Start       time.Time
 	Depth       int
-	Nodes       int
+	SelDepth    int
 	CurrentMove Move
 
 	Extensions int
+
+	Limits     SearchLimits
+	Options    SearchOptions
+	Threads    int
+	Heuristics *SearchHeuristics
+
+	OnIteration func(*SearchContext)
+
+	nodes    atomic.Int64
+	deadline atomic.Int64
+	stopped  atomic.Bool
+
+	main *SearchContext
+	// helpers is read by Nodes while the search is running, from whichever
+	// goroutine reports progress
+	helpers atomic.Pointer[[]*SearchContext]
+
+	pv    [SearchMaxPly + 1][SearchMaxPly + 1]Move
+	pvlen [SearchMaxPly + 1]int
+	stack [SearchMaxPly + 1]MovePicker
+}
+
+type SearchOptions struct {
+	PVS                bool
+	NullMovePruning    bool
+	LateMoveReductions bool
+}
+
+type SearchLimits struct {
+	Depth int
+	Nodes int
+	Mate  int
+	Moves []Move
 }
 
 const (
 	SearchMaxDepth      = 32
+	SearchMaxPly        = 128
 	SearchMaxExtensions = 3
 )
 
+var SearchReductions = func() func(int, int) int {
+	var lookup [SearchMaxPly][256]int
+
+	for depth := 1; depth < SearchMaxPly; depth++ {
+		for index := 1; index < 256; index++ {
+			lookup[depth][index] = int(0.75 + math.Log(float64(depth))*math.Log(float64(index))/2.25)
+		}
+	}
+
+	return func(depth, index int) int {
+		return lookup[min(depth, SearchMaxPly-1)][min(index, 255)]
+	}
+}()
+
 func Search(sctx *SearchContext) {
 	sctx.Start = time.Now()
 
-	for sctx.Depth = 1; sctx.Depth <= SearchMaxDepth; sctx.Depth++ {
+	if sctx.Heuristics == nil {
+		sctx.Heuristics = &SearchHeuristics{}
+	}
+
+	sctx.Heuristics.Age()
+
+	helpers := []*SearchContext(nil)
+
+	for range sctx.Threads - 1 {
+		helpers = append(helpers, &SearchContext{
+			Context:    sctx.Context,
+			Game:       sctx.Game.Clone(),
+			TT:         sctx.TT,
+			Start:      sctx.Start,
+			Limits:     sctx.Limits,
+			Options:    sctx.Options,
+			Heuristics: &SearchHeuristics{},
+			main:       sctx,
+		})
+	}
+
+	sctx.helpers.Store(&helpers)
+
+	wg := sync.WaitGroup{}
+
+	for id, helper := range helpers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			helper.help(id + 1)
+		}()
+	}
+
+	defer func() {
+		sctx.stopped.Store(true)
+		wg.Wait()
+	}()
+
+	depth := sctx.MaxDepth()
+
+	for sctx.Depth = 1; sctx.Depth <= depth; sctx.Depth++ {
 		start := time.Now()
 
 		slog.Debug("starting iteration", "depth", sctx.Depth)
 
-		if sctx.Err() != nil {
+		if sctx.Stopped() {
 			slog.Warn("search aborted")
 			break
 		}
 
-		eval := search(sctx, sctx.Depth, -EvalInf, EvalInf)
+		sctx.SelDepth = 0
+
+		eval := search(sctx, sctx.Depth, 0, -EvalInf, EvalInf)
+
+		if sctx.Stopped() {
+			slog.Warn("search aborted")
+			break
+		}
+
+		if sctx.pvlen[0] > 0 {
+			sctx.Best = sctx.pv[0][0]
+			sctx.PV = append(sctx.PV[:0], sctx.pv[0][:sctx.pvlen[0]]...)
+		}
+
+		sctx.Eval = eval
+
 		slog.Debug("completed iteration", "depth", sctx.Depth, "eval", eval, "bestmove", sctx.Best)
 
+		if sctx.OnIteration != nil {
+			sctx.OnIteration(sctx)
+		}
+
 		if n, ok := eval.MateIn(); ok {
 			slog.Debug("mate", "in", n, "move", sctx.Best)
-			break
+
+			if sctx.Limits.Mate == 0 || (eval > 0 && (n+1)/2 <= sctx.Limits.Mate) {
+				break
+			}
 		}
 
 		deadline, ok := sctx.Deadline()
@@ -59,85 +177,212 @@ func Search(sctx *SearchContext) {
 		}
 	}
 
-	if sctx.Best.IsZero() {
-		moves := GenerateMoves(sctx.Game.Board(), MoveGenerationOptions{})
+	if moves := sctx.RootMoves(); sctx.Best.IsZero() && len(moves) > 0 {
 		sctx.Best = moves[0]
+		sctx.PV = []Move{sctx.Best}
 
 		slog.Warn("failed to find best move, selected first", "move", sctx.Best)
 	}
 }
 
-func search(sctx *SearchContext, depth int, alpha, beta Eval) Eval {
-	if sctx.Err() != nil {
+func (sctx *SearchContext) help(id int) {
+	// helpers skip alternate depths so that threads diverge and fill the
+	// shared transposition table with different parts of the tree
+	for sctx.Depth = 1 + id%2; sctx.Depth <= sctx.MaxDepth(); sctx.Depth++ {
+		if sctx.Stopped() {
+			break
+		}
+
+		search(sctx, sctx.Depth, 0, -EvalInf, EvalInf)
+
+		if !sctx.Stopped() && sctx.pvlen[0] > 0 {
+			sctx.Best = sctx.pv[0][0]
+		}
+	}
+}
+
+func (sctx *SearchContext) MaxDepth() int {
+	depth := SearchMaxDepth
+
+	if sctx.Limits.Depth > 0 {
+		depth = min(depth, sctx.Limits.Depth)
+	}
+
+	if sctx.Limits.Mate > 0 {
+		depth = min(depth, sctx.Limits.Mate*2)
+	}
+
+	return depth
+}
+
+func (sctx *SearchContext) Nodes() int {
+	nodes := sctx.nodes.Load()
+
+	if helpers := sctx.helpers.Load(); helpers != nil {
+		for _, helper := range *helpers {
+			nodes += helper.nodes.Load()
+		}
+	}
+
+	return int(nodes)
+}
+
+func (sctx *SearchContext) Deadline() (time.Time, bool) {
+	if deadline := sctx.deadline.Load(); deadline != 0 {
+		return time.Unix(0, deadline), true
+	}
+
+	return sctx.Context.Deadline()
+}
+
+func (sctx *SearchContext) SetDeadline(deadline time.Time) {
+	sctx.deadline.Store(deadline.UnixNano())
+}
+
+func (sctx *SearchContext) Stopped() bool {
+	main := sctx
+
+	if sctx.main != nil {
+		main = sctx.main
+	}
+
+	if main.stopped.Load() {
+		return true
+	}
+
+	if sctx.Limits.Nodes > 0 && main.Nodes() >= sctx.Limits.Nodes {
+		return true
+	}
+
+	return sctx.Err() != nil
+}
+
+func (sctx *SearchContext) RootMoves() []Move {
+	moves := GenerateMoves(sctx.Game.Board(), MoveGenerationOptions{})
+
+	if len(sctx.Limits.Moves) > 0 {
+		moves = slices.DeleteFunc(moves, func(move Move) bool {
+			return !slices.Contains(sctx.Limits.Moves, move)
+		})
+	}
+
+	return moves
+}
+
+func search(sctx *SearchContext, depth, ply int, alpha, beta Eval) Eval {
+	if sctx.Stopped() {
 		return 0
 	}
 
-	if depth != sctx.Depth {
+	sctx.pvlen[ply] = 0
+
+	if ply > 0 {
 		if sctx.Game.Board().Moves.Half >= 100 {
 			return 0
 		}
 
-		for b := range sctx.Game.Boards() {
-			if b != sctx.Game.Board() && b.Zobrist == sctx.Game.Board().Zobrist {
-				return 0
-			}
+		if sctx.Game.IsRepetition() {
+			return 0
 		}
-	}
 
-	if t, ok := sctx.TT.Get(sctx.Game.Board().Zobrist); ok && t.Depth >= depth {
-		if sctx.Extensions == 0 && depth == sctx.Depth {
-			sctx.Best = t.Best
+		if ply >= SearchMaxPly {
+			return Evaluate(sctx.Game.Board())
 		}
+	}
 
-		switch t.Bound {
-		case BoundBeta:
-			if t.Eval >= beta {
-				return beta
-			}
+	first := sctx.Best
 
-		case BoundAlpha:
-			if t.Eval <= alpha {
-				return alpha
-			}
+	if t, ok := sctx.TT.Get(sctx.Game.Board().Zobrist); ok && ply > 0 {
+		first = t.Best
+
+		if t.Depth >= depth {
+			switch t.Bound {
+			case BoundBeta:
+				if t.Eval >= beta {
+					return beta
+				}
+
+			case BoundAlpha:
+				if t.Eval <= alpha {
+					return alpha
+				}
 
-		case BoundExact:
-			return t.Eval
+			case BoundExact:
+				return t.Eval
+			}
 		}
 	}
 
 	if depth == 0 {
-		sctx.Nodes++
+		return quiesce(sctx, ply, alpha, beta)
+	}
+
+	sctx.nodes.Add(1)
+
+	check := sctx.Game.Board().Attacks.Checks > 0
+	pv := beta-alpha > 1
+
+	if sctx.Options.NullMovePruning && !pv && !check && ply > 0 && depth >= 3 && !sctx.Game.Board().Moves.Last.IsZero() {
+		b := sctx.Game.Board()
+
+		pieces := b.Bits.Pieces[Knight].
+			Set(b.Bits.Pieces[Bishop]).
+			Set(b.Bits.Pieces[Rook]).
+			Set(b.Bits.Pieces[Queen]).
+			And(b.Bits.Players[b.Player])
 
-		return quiesce(sctx, alpha, beta)
+		// skip positions with only pawns left where zugzwang is likely
+		if pieces != 0 && Evaluate(b) >= beta {
+			reduction := 2
+			if depth > 6 {
+				reduction = 3
+			}
+
+			sctx.Game.MakeNullMove()
+			eval := -search(sctx, max(0, depth-1-reduction), ply+1, -beta, -beta+1)
+			sctx.Game.UnmakeMove()
+
+			if eval >= beta && !sctx.Stopped() {
+				return beta
+			}
+		}
 	}
 
-	moves := GenerateMoves(sctx.Game.Board(), MoveGenerationOptions{})
 	trans := Transposition{
 		Key:   sctx.Game.Board().Zobrist,
 		Depth: depth,
 		Bound: BoundAlpha,
 	}
 
-	if len(moves) == 0 {
-		if sctx.Game.Board().Attacks.Checks > 0 {
-			return -(EvalMate - Eval(sctx.Depth-depth))
-		}
+	picker := &sctx.stack[ply]
+	picker.Reset(sctx.Game.Board(), sctx.Heuristics, ply, first)
 
-		return 0
-	}
+	searched := 0
 
-	OrderMoves(sctx.Game.Board(), sctx.Best, moves)
+	for {
+		move, ok := picker.Next()
+		if !ok {
+			break
+		}
+
+		if ply == 0 {
+			if len(sctx.Limits.Moves) > 0 && !slices.Contains(sctx.Limits.Moves, move) {
+				continue
+			}
 
-	for _, move := range moves {
-		if depth == sctx.Depth {
 			sctx.CurrentMove = move
 		}
 
+		i := searched
+		searched++
+
 		sctx.Game.MakeMove(move)
 
+		gives := sctx.Game.Board().Attacks.Checks > 0
+
 		extension := 0
 		if sctx.Extensions < SearchMaxExtensions {
-			if sctx.Game.Board().Attacks.Checks > 0 {
+			if gives {
 				extension = 1
 			} else if move.Flags&MoveFlagPromoteAny != 0 {
 				extension = 1
@@ -146,13 +391,36 @@ func search(sctx *SearchContext, depth int, alpha, beta Eval) Eval {
 
 		sctx.Extensions += extension
 
-		eval := -search(sctx, depth-1+extension, -beta, -alpha)
+		reduction := 0
+		if sctx.Options.LateMoveReductions && i >= 3 && depth >= 3 && extension == 0 && !check && !gives {
+			if move.Flags&(MoveFlagCapture|MoveFlagPromoteAny) == 0 {
+				reduction = min(SearchReductions(depth, i), depth-2)
+			}
+		}
+
+		window := beta
+		if sctx.Options.PVS && i > 0 {
+			window = alpha + 1
+		}
+
+		eval := -search(sctx, depth-1+extension-reduction, ply+1, -window, -alpha)
+
+		if reduction > 0 && eval > alpha {
+			eval = -search(sctx, depth-1+extension, ply+1, -window, -alpha)
+		}
+
+		if window != beta && eval > alpha && eval < beta {
+			eval = -search(sctx, depth-1+extension, ply+1, -beta, -alpha)
+		}
+
 		sctx.Game.UnmakeMove()
 
 		sctx.Extensions -= extension
 
 		if eval >= beta {
-			if sctx.Err() == nil {
+			if !sctx.Stopped() {
+				sctx.Heuristics.Update(sctx.Game.Board(), ply, depth, move)
+
 				sctx.TT.Store(Transposition{
 					Key:   sctx.Game.Board().Zobrist,
 					Eval:  beta,
@@ -164,41 +432,60 @@ func search(sctx *SearchContext, depth int, alpha, beta Eval) Eval {
 
 			return beta
 		} else if eval > alpha {
-			if sctx.Err() == nil {
+			if !sctx.Stopped() {
 				trans.Best = move
 				trans.Bound = BoundExact
+
+				sctx.pv[ply][0] = move
+				sctx.pvlen[ply] = copy(sctx.pv[ply][1:], sctx.pv[ply+1][:sctx.pvlen[ply+1]]) + 1
 			}
 
 			alpha = eval
 		}
 	}
 
+	if searched == 0 {
+		if sctx.Game.Board().Attacks.Checks > 0 {
+			return -(EvalMate - Eval(ply))
+		}
+
+		return 0
+	}
+
 	trans.Eval = alpha
 
-	if sctx.Err() == nil {
+	if !sctx.Stopped() {
 		sctx.TT.Store(trans)
-
-		if sctx.Extensions == 0 && depth == sctx.Depth {
-			sctx.Best = trans.Best
-		}
 	}
 
 	return trans.Eval
 }
 
-func quiesce(sctx *SearchContext, alpha, beta Eval) Eval {
+func quiesce(sctx *SearchContext, ply int, alpha, beta Eval) Eval {
+	sctx.nodes.Add(1)
+	sctx.SelDepth = max(sctx.SelDepth, ply)
+
 	if eval := Evaluate(sctx.Game.Board()); eval >= beta {
 		return eval
 	} else if eval > alpha {
 		alpha = eval
 	}
 
-	moves := GenerateMoves(sctx.Game.Board(), MoveGenerationOptions{CapturesOnly: true})
-	OrderMoves(sctx.Game.Board(), Move{}, moves)
+	if ply >= SearchMaxPly {
+		return alpha
+	}
+
+	picker := &sctx.stack[ply]
+	picker.ResetQuiescence(sctx.Game.Board())
+
+	for {
+		move, ok := picker.Next()
+		if !ok {
+			break
+		}
 
-	for _, move := range moves {
 		sctx.Game.MakeMove(move)
-		eval := -quiesce(sctx, -beta, -alpha)
+		eval := -quiesce(sctx, ply+1, -beta, -alpha)
 		sctx.Game.UnmakeMove()
 
 		if eval >= beta {
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSearch(t *testing.T, fen string, limits SearchLimits) *SearchContext {
+	t.Helper()
+
+	game, err := GameFromFEN(fen)
+	require.NoError(t, err)
+
+	return &SearchContext{
+		Context: context.Background(),
+		Game:    game,
+		TT:      NewTranspositionTable(1024 * 1024),
+		Limits:  limits,
+		Threads: 1,
+		Options: SearchOptions{
+			PVS:                true,
+			NullMovePruning:    true,
+			LateMoveReductions: true,
+		},
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	t.Run("depth", func(t *testing.T) {
+		sctx := newTestSearch(t, BoardStartPos, SearchLimits{Depth: 3})
+
+		depths := []int(nil)
+		sctx.OnIteration = func(sctx *SearchContext) {
+			depths = append(depths, sctx.Depth)
+		}
+
+		Search(sctx)
+
+		assert.Equal(t, []int{1, 2, 3}, depths)
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		sctx := newTestSearch(t, BoardStartPos, SearchLimits{Nodes: 5000})
+
+		Search(sctx)
+
+		// quiescence doesn't check limits, so allow some overshoot
+		assert.GreaterOrEqual(t, sctx.Nodes(), 5000)
+		assert.Less(t, sctx.Nodes(), 10000)
+		assert.False(t, sctx.Best.IsZero())
+	})
+
+	t.Run("mate", func(t *testing.T) {
+		sctx := newTestSearch(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", SearchLimits{Mate: 1})
+
+		Search(sctx)
+
+		assert.Equal(t, "a1a8", sctx.Best.String())
+		assert.Equal(t, "mate 1", UCIScore(sctx.Eval))
+		assert.LessOrEqual(t, sctx.Depth, 2)
+	})
+
+	t.Run("searchmoves", func(t *testing.T) {
+		move := NewMove(SquareA2, SquareA3)
+		sctx := newTestSearch(t, BoardStartPos, SearchLimits{Depth: 3, Moves: []Move{move}})
+
+		Search(sctx)
+
+		assert.Equal(t, move, sctx.Best)
+		assert.Equal(t, []Move{move}, sctx.RootMoves())
+	})
+}
+
+func TestSearchThreads(t *testing.T) {
+	// long enough for the helpers to get going before the main thread stops
+	sctx := newTestSearch(t, BoardStartPos, SearchLimits{Nodes: 50000})
+	sctx.Threads = 4
+
+	done := make(chan struct{})
+	reported := make(chan int)
+
+	// progress is reported from another goroutine while the helpers start
+	go func() {
+		nodes := 0
+
+		for {
+			select {
+			case <-done:
+				reported <- nodes
+				return
+
+			default:
+				nodes = max(nodes, sctx.Nodes())
+			}
+		}
+	}()
+
+	Search(sctx)
+	close(done)
+
+	assert.False(t, sctx.Best.IsZero())
+	assert.Greater(t, sctx.Nodes(), int(sctx.nodes.Load()), "helpers count towards the total")
+	assert.LessOrEqual(t, <-reported, sctx.Nodes())
+}
+
+func TestSearchOptions(t *testing.T) {
+	for _, pvs := range []bool{false, true} {
+		for _, nmp := range []bool{false, true} {
+			for _, lmr := range []bool{false, true} {
+				options := SearchOptions{PVS: pvs, NullMovePruning: nmp, LateMoveReductions: lmr}
+
+				sctx := newTestSearch(t, "k7/8/2K5/8/8/8/8/7R w - - 0 1", SearchLimits{Mate: 2})
+				sctx.Options = options
+
+				Search(sctx)
+
+				assert.Equal(t, "mate 2", UCIScore(sctx.Eval), "%+v", options)
+			}
+		}
+	}
+
+	t.Run("middlegame", func(t *testing.T) {
+		fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+		none := newTestSearch(t, fen, SearchLimits{Depth: 5})
+		none.Options = SearchOptions{}
+		Search(none)
+
+		pruned := newTestSearch(t, fen, SearchLimits{Depth: 5})
+		Search(pruned)
+
+		// the same depth is reached with fewer nodes
+		assert.Less(t, pruned.Nodes(), none.Nodes())
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+func AttackersTo(b *Board, sq Square, occupied Bitboard) Bitboard {
+	orthogonal := b.Bits.Pieces[Rook].Set(b.Bits.Pieces[Queen])
+	diagonal := b.Bits.Pieces[Bishop].Set(b.Bits.Pieces[Queen])
+
+	return PawnAttacks[Black][sq].And(b.Bits.Pieces[Pawn]).And(b.Bits.Players[White]).
+		Set(PawnAttacks[White][sq].And(b.Bits.Pieces[Pawn]).And(b.Bits.Players[Black])).
+		Set(KnightAttacks[sq].And(b.Bits.Pieces[Knight])).
+		Set(KingAttacks[sq].And(b.Bits.Pieces[King])).
+		Set(MagicOrthogonalMoves(sq, occupied).And(orthogonal)).
+		Set(MagicDiagonalMoves(sq, occupied).And(diagonal)).
+		And(occupied)
+}
+
+func SEE(b *Board, move Move) Eval {
+	gain := [32]Eval{}
+
+	occupied := b.Bits.All.Unoccupy(move.From)
+	attacker := b.Squares[move.From].Type()
+
+	if move.Flags&MoveFlagCaptureEnPassant != 0 {
+		gain[0] = EvaluatePiece(Pawn)
+		occupied = occupied.Unoccupy(NewSquare(move.To.File(), move.From.Rank()))
+	} else if victim := b.Squares[move.To]; victim != EmptySquare {
+		gain[0] = EvaluatePiece(victim.Type())
+	}
+
+	if promotion, ok := move.Promotion(); ok {
+		gain[0] += EvaluatePiece(promotion) - EvaluatePiece(Pawn)
+		attacker = promotion
+	}
+
+	orthogonal := b.Bits.Pieces[Rook].Set(b.Bits.Pieces[Queen])
+	diagonal := b.Bits.Pieces[Bishop].Set(b.Bits.Pieces[Queen])
+
+	attackers := AttackersTo(b, move.To, occupied)
+	player := b.Player.Opponent()
+
+	depth := 0
+
+	for depth < len(gain)-1 {
+		candidates := attackers.And(b.Bits.Players[player])
+		if candidates == 0 {
+			break
+		}
+
+		src, ptype := Square(0), PieceType(0)
+
+		for pt := Pawn; pt <= King; pt++ {
+			if pieces := candidates.And(b.Bits.Pieces[pt]); pieces != 0 {
+				_, src = pieces.PopLSB()
+				ptype = pt
+				break
+			}
+		}
+
+		// the king can't capture into a square that is still defended
+		if ptype == King && attackers.And(b.Bits.Players[player.Opponent()]) != 0 {
+			break
+		}
+
+		depth++
+		gain[depth] = EvaluatePiece(attacker) - gain[depth-1]
+
+		occupied = occupied.Unoccupy(src)
+		attackers = attackers.Unoccupy(src)
+
+		// reveal any x-ray attackers behind the piece that just captured
+		if ptype == Pawn || ptype == Bishop || ptype == Queen {
+			attackers = attackers.Set(MagicDiagonalMoves(move.To, occupied).And(diagonal))
+		}
+
+		if ptype == Rook || ptype == Queen {
+			attackers = attackers.Set(MagicOrthogonalMoves(move.To, occupied).And(orthogonal))
+		}
+
+		attackers = attackers.And(occupied)
+		attacker = ptype
+		player = player.Opponent()
+	}
+
+	for ; depth > 0; depth-- {
+		gain[depth-1] = -max(-gain[depth-1], gain[depth])
+	}
+
+	return gain[0]
+}
+
+// ScoreCapture orders captures by what they win once the exchange has played
+// out, using MVV-LVA to break ties. It is negative for losing captures.
+func ScoreCapture(b *Board, move Move) int {
+	// MVV-LVA scores are all below 64
+	return int(SEE(b, move))*64 + ScoreMove(b, move)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSEE(t *testing.T) {
+	tests := map[string]struct {
+		fen      string
+		move     string
+		expected Eval
+	}{
+		"undefended":        {"4k3/8/8/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", 100},
+		"defended by pawn":  {"4k3/8/4p3/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", -400},
+		"even trade":        {"4k3/8/4p3/3n4/8/4N3/8/4K3 w - - 0 1", "e3d5", 0},
+		"en passant":        {"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		"king defends":      {"8/8/4k3/3p4/8/8/8/3RK3 w - - 0 1", "d1d5", -400},
+		"king can't defend": {"8/8/4k3/3p4/8/1B6/8/3RK3 w - - 0 1", "d1d5", 100},
+		// the rook behind the first one joins in once it has captured
+		"x-ray rook": {"3rk3/8/8/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 100},
+		"x-ray both": {"3rk3/3r4/8/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", -400},
+		// the bishop sees through the pawn that captures first
+		"x-ray behind pawn":      {"4k3/8/2p5/3p4/4P3/5B2/8/4K3 w - - 0 1", "e4d5", 100},
+		"king takes promotion":   {"3rk3/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7d8q", 400},
+		"defended promotion":     {"3rk3/4P3/8/8/8/8/8/3RK3 w - - 0 1", "e7d8q", 1300},
+		"rook takes pawn":        {"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		"x-ray queens and rooks": {"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -220},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := BoardFromFEN(test.fen)
+			require.NoError(t, err)
+
+			move, err := ParseUCIMove(&b, test.move)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, SEE(&b, move))
+		})
+	}
+}
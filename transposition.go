@@ -2,6 +2,7 @@ package main
 
 import (
 	"log/slog"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -21,19 +22,24 @@ const (
 	BoundExact
 )
 
-type TranspositionTable struct {
-	entries []Transposition
+// entries are stored as two words with the key xor'd with the data so that
+// torn writes from concurrent searches are detected and discarded on read.
+type transpositionEntry struct {
+	key  atomic.Uint64
+	data atomic.Uint64
 }
 
-const TranspositionTableSize = 128 * 1024 * 1024
+type TranspositionTable struct {
+	entries []transpositionEntry
+}
 
-func NewTranspositionTable() *TranspositionTable {
-	size := TranspositionTableSize / unsafe.Sizeof(Transposition{})
+func NewTranspositionTable(bytes uintptr) *TranspositionTable {
+	size := max(1, bytes/unsafe.Sizeof(transpositionEntry{}))
 
 	slog.Debug("initializing transposition table", "size", size)
 
 	return &TranspositionTable{
-		entries: make([]Transposition, size),
+		entries: make([]transpositionEntry, size),
 	}
 }
 
@@ -42,13 +48,56 @@ func (tt *TranspositionTable) index(key Zobrist) Zobrist {
 }
 
 func (tt *TranspositionTable) Get(key Zobrist) (Transposition, bool) {
-	if entry := tt.entries[tt.index(key)]; entry.Key == key {
-		return entry, true
+	entry := &tt.entries[tt.index(key)]
+
+	data := entry.data.Load()
+	if Zobrist(entry.key.Load()^data) != key {
+		return Transposition{}, false
 	}
 
-	return Transposition{}, false
+	return Transposition{
+		Key:   key,
+		Eval:  Eval(int32(data)),
+		Depth: int(uint8(data >> 32)),
+		Bound: Bound((data >> 40) & 0b11),
+		Best: Move{
+			From:  Square((data >> 42) & 0b111111),
+			To:    Square((data >> 48) & 0b111111),
+			Flags: MoveFlags((data >> 54) & 0b111111111),
+		},
+	}, true
+}
+
+func (tt *TranspositionTable) Store(t Transposition) {
+	data := uint64(uint32(int32(t.Eval))) |
+		uint64(uint8(min(t.Depth, 255)))<<32 |
+		uint64(t.Bound)<<40 |
+		uint64(t.Best.From)<<42 |
+		uint64(t.Best.To)<<48 |
+		uint64(t.Best.Flags)<<54
+
+	entry := &tt.entries[tt.index(t.Key)]
+
+	entry.key.Store(uint64(t.Key) ^ data)
+	entry.data.Store(data)
+}
+
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.entries {
+		tt.entries[i].key.Store(0)
+		tt.entries[i].data.Store(0)
+	}
 }
 
-func (tt *TranspositionTable) Store(entry Transposition) {
-	tt.entries[tt.index(entry.Key)] = entry
+func (tt *TranspositionTable) Hashfull() int {
+	used := 0
+	sample := min(1000, len(tt.entries))
+
+	for i := range sample {
+		if tt.entries[i].key.Load() != 0 {
+			used++
+		}
+	}
+
+	return used * 1000 / sample
 }
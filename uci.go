@@ -6,29 +6,58 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+const UCIMaxThreads = 256
+
 type UCI struct {
 	OpeningBook         bool          `help:"Use opening book to play opening moves" default:"true" negatable:""`
 	OpeningBookMoves    int           `help:"Number of moves to play from the opening book" default:"20"`
+	BookFile            string        `help:"Polyglot opening book to try before the built-in book" type:"existingfile" env:"CHESTER_BOOK_FILE"`
+	BookPolicy          string        `help:"How to choose between moves in the built-in book" enum:"uniform,best,games,score,priority" default:"uniform" env:"CHESTER_BOOK_POLICY"`
+	BookMinGames        int           `help:"Ignore built-in book moves played in fewer games" default:"0" env:"CHESTER_BOOK_MIN_GAMES"`
+	BookSeed            int           `help:"Seed for choosing book moves, 0 for a random seed" default:"0" env:"CHESTER_BOOK_SEED"`
 	DefaultMoveTime     time.Duration `help:"Default time to spend calculating the best move" default:"1s" env:"CHESTER_DEFAULT_MOVE_TIME"`
 	DefaultInfoInterval time.Duration `help:"Default interval to send info messages" default:"500ms"`
+	MoveOverhead        time.Duration `help:"Time to reserve for communication delays when playing on a clock" default:"50ms" env:"CHESTER_MOVE_OVERHEAD"`
+	Hash                int           `help:"Size of the transposition table in megabytes" default:"128" env:"CHESTER_HASH"`
+	Threads             int           `help:"Number of threads to search with" default:"1" env:"CHESTER_THREADS"`
+	AnalyseMode         bool          `help:"Accept positions that fail strict FEN validation" default:"false" env:"CHESTER_ANALYSE_MODE"`
+
+	PVS                bool `help:"Use principal variation search" default:"true" negatable:"" env:"CHESTER_PVS"`
+	NullMovePruning    bool `help:"Use null move pruning" default:"true" negatable:"" env:"CHESTER_NULL_MOVE_PRUNING"`
+	LateMoveReductions bool `help:"Use late move reductions" default:"true" negatable:"" env:"CHESTER_LATE_MOVE_REDUCTIONS"`
 
 	stdin  io.Reader
 	stdout io.Writer
+	output sync.Mutex
 
 	quit  bool
 	debug bool
 
-	game *Game
-	tt   *TranspositionTable
-	sctx *SearchContext
-	stop func()
+	options UCIOptions
+
+	book     *PolyglotBook
+	selector *OpeningSelector
+
+	game       *Game
+	tt         *TranspositionTable
+	heuristics *SearchHeuristics
+
+	// mu guards the state shared with the goroutine running a search, which
+	// clears it when the search finishes.
+	mu            sync.Mutex
+	sctx          *SearchContext
+	stop          func()
+	ponder        chan struct{}
+	ponderTimeout time.Duration
 }
 
 func (uci *UCI) Run(ctx context.Context) error {
@@ -39,11 +68,103 @@ func (uci *UCI) Run(ctx context.Context) error {
 
 	slog.Info("starting uci engine")
 
-	uci.tt = NewTranspositionTable()
+	uci.init()
+
+	// the embedded book is indexed once here, so a corrupt one stops the
+	// engine instead of being ignored on every move
+	if _, err := _OpeningIndex(); err != nil {
+		return fmt.Errorf("built-in %w", err)
+	}
+
+	if err := uci.loadBook(uci.BookFile); err != nil {
+		return err
+	}
 
 	return uci.run(ctx)
 }
 
+func (uci *UCI) init() {
+	uci.tt = NewTranspositionTable(uintptr(uci.Hash) * 1024 * 1024)
+	uci.heuristics = &SearchHeuristics{}
+	uci.options = uci.newOptions()
+
+	uci.selector = uci.newSelector()
+}
+
+func (uci *UCI) newOptions() UCIOptions {
+	return UCIOptions{
+		NewUCISpinOption("Hash", uci.Hash, 1, 65536, func(mb int) {
+			uci.Hash = mb
+			uci.tt = NewTranspositionTable(uintptr(mb) * 1024 * 1024)
+		}),
+		NewUCIButtonOption("Clear Hash", func() {
+			uci.tt.Clear()
+		}),
+		NewUCISpinOption("Threads", uci.Threads, 1, UCIMaxThreads, func(n int) {
+			uci.Threads = n
+		}),
+		NewUCICheckOption("OwnBook", uci.OpeningBook, func(enabled bool) {
+			uci.OpeningBook = enabled
+		}),
+		NewUCISpinOption("Book Moves", uci.OpeningBookMoves, 0, 1000, func(n int) {
+			uci.OpeningBookMoves = n
+		}),
+		NewUCIStringOption("BookFile", uci.BookFile, uci.loadBook),
+		NewUCIComboOption("Book Policy", uci.BookPolicy, OpeningPolicies, func(policy string) {
+			uci.BookPolicy = policy
+			uci.selector.Policy = OpeningPolicy(policy)
+		}),
+		NewUCISpinOption("Book Min Games", uci.BookMinGames, 0, math.MaxInt32, func(n int) {
+			uci.BookMinGames = n
+			uci.selector.MinGames = n
+		}),
+		NewUCISpinOption("Book Seed", uci.BookSeed, 0, math.MaxInt32, func(seed int) {
+			uci.BookSeed = seed
+			uci.selector = uci.newSelector()
+		}),
+		NewUCISpinOption("Move Time", int(uci.DefaultMoveTime.Milliseconds()), 1, 3600000, func(ms int) {
+			uci.DefaultMoveTime = time.Duration(ms) * time.Millisecond
+		}),
+		NewUCISpinOption("Move Overhead", int(uci.MoveOverhead.Milliseconds()), 0, 10000, func(ms int) {
+			uci.MoveOverhead = time.Duration(ms) * time.Millisecond
+		}),
+		NewUCICheckOption("UCI_AnalyseMode", uci.AnalyseMode, func(enabled bool) {
+			uci.AnalyseMode = enabled
+		}),
+		NewUCICheckOption("PVS", uci.PVS, func(enabled bool) {
+			uci.PVS = enabled
+		}),
+		NewUCICheckOption("NullMovePruning", uci.NullMovePruning, func(enabled bool) {
+			uci.NullMovePruning = enabled
+		}),
+		NewUCICheckOption("LateMoveReductions", uci.LateMoveReductions, func(enabled bool) {
+			uci.LateMoveReductions = enabled
+		}),
+	}
+}
+
+func (uci *UCI) newSelector() *OpeningSelector {
+	return NewOpeningSelector(OpeningPolicy(uci.BookPolicy), uci.BookMinGames, int64(uci.BookSeed))
+}
+
+func (uci *UCI) loadBook(path string) error {
+	if path == "" {
+		uci.BookFile, uci.book = "", nil
+		return nil
+	}
+
+	book, err := LoadPolyglotBook(path)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("loaded polyglot book", "path", path, "entries", book.Len())
+
+	uci.BookFile, uci.book = path, book
+
+	return nil
+}
+
 func (uci *UCI) run(ctx context.Context) error {
 	input := bufio.NewScanner(uci.stdin)
 
@@ -71,15 +192,33 @@ func (uci *UCI) run(ctx context.Context) error {
 }
 
 func (uci *UCI) handle(ctx context.Context, cmd UCICommand) {
+	uci.mu.Lock()
+	defer uci.mu.Unlock()
+
 	switch name := cmd.Name(); name {
 	case "uci":
+		uci.send("id name chester")
+		uci.send("id author johnfrankmorgan")
+
+		for _, option := range uci.options {
+			uci.send(option)
+		}
+
 		uci.send("uciok")
 
 	case "isready":
 		uci.send("readyok")
 
 	case "ucinewgame":
-		// no-op for now
+		if uci.sctx != nil {
+			slog.Warn("cannot start new game while searching")
+			return
+		}
+
+		uci.heuristics.Clear()
+
+		// restart the book's random sequence so seeded games repeat
+		uci.selector = uci.newSelector()
 
 	case "debug":
 		uci.debug = cmd.BoolArg("on")
@@ -90,6 +229,20 @@ func (uci *UCI) handle(ctx context.Context, cmd UCICommand) {
 	case "print":
 		uci.send(uci.game.Board())
 
+	case "d", "fen":
+		if uci.game == nil {
+			slog.Warn("no position set")
+			return
+		}
+
+		if name == "fen" {
+			uci.send(uci.game.FEN())
+			return
+		}
+
+		uci.send(uci.game.Board())
+		uci.send("Fen:", uci.game.FEN())
+
 	case "go":
 		if uci.game == nil {
 			slog.Warn("no position set")
@@ -113,51 +266,54 @@ func (uci *UCI) handle(ctx context.Context, cmd UCICommand) {
 			return
 		}
 
-		if cmd.BoolArg("infinite") {
-			ctx, cancel := context.WithCancel(ctx)
-			uci.stop = cancel
+		limits := uci.limits(cmd)
+		timeout := uci.timeout(cmd)
 
-			slog.Debug("starting infinite search")
-			go uci.search(ctx)
-		} else {
-			timeout := time.Duration(0)
+		timed := cmd.BoolArg("movetime") || cmd.BoolArg("wtime") || cmd.BoolArg("btime")
+		infinite := cmd.BoolArg("infinite") || (!timed && (limits.Depth > 0 || limits.Nodes > 0 || limits.Mate > 0))
 
-			if mtime, ok := cmd.IntArg("movetime"); ok {
-				timeout = time.Duration(mtime) * time.Millisecond
-			} else {
-				remaining := [ColorCount]time.Duration{}
-				increment := [ColorCount]time.Duration{}
+		cancel := context.CancelFunc(nil)
 
-				remaining[White], _ = cmd.DurationArg("wtime")
-				increment[White], _ = cmd.DurationArg("winc")
+		switch {
+		case cmd.BoolArg("ponder"):
+			ctx, cancel = context.WithCancel(ctx)
 
-				remaining[Black], _ = cmd.DurationArg("btime")
-				increment[Black], _ = cmd.DurationArg("binc")
+			uci.ponder = make(chan struct{})
+			uci.ponderTimeout = timeout
 
-				player := uci.game.Board().Player
-				timeout = remaining[player]/40 + increment[player]/2
+			if infinite {
+				uci.ponderTimeout = 0
+			}
 
-				if timeout >= remaining[player] {
-					timeout = remaining[player] - 500*time.Millisecond
-				}
+			slog.Debug("starting ponder search", "timeout", uci.ponderTimeout, "limits", limits)
 
-				if timeout < 0 {
-					timeout = 100 * time.Millisecond
-				}
-			}
+		case infinite:
+			ctx, cancel = context.WithCancel(ctx)
 
-			if timeout == 0 {
-				timeout = uci.DefaultMoveTime
-				slog.Debug("using default movetime", "timeout", timeout)
-			} else {
-				slog.Debug("using movetime", "timeout", timeout)
-			}
+			slog.Debug("starting unbounded search", "limits", limits)
 
-			ctx, cancel := context.WithTimeout(ctx, timeout)
-			uci.stop = cancel
+		default:
+			ctx, cancel = context.WithTimeout(ctx, timeout)
 
-			slog.Debug("starting movetime search", "timeout", timeout)
-			go uci.search(ctx)
+			slog.Debug("starting movetime search", "timeout", timeout, "limits", limits)
+		}
+
+		uci.stop = cancel
+		uci.search(ctx, limits)
+
+	case "bench":
+		if uci.sctx != nil {
+			slog.Warn("search already in progress")
+			return
+		}
+
+		depth, ok := cmd.IntArg("depth")
+		if !ok {
+			depth = BenchDepth
+		}
+
+		if _, err := Bench(ctx, uci.stdout, depth, BenchHash); err != nil {
+			slog.Warn("bench failed", "error", err)
 		}
 
 	case "stop":
@@ -166,12 +322,42 @@ func (uci *UCI) handle(ctx context.Context, cmd UCICommand) {
 			return
 		}
 
+		if uci.ponder != nil {
+			close(uci.ponder)
+			uci.ponder = nil
+		}
+
 		uci.stop()
 
-	case "setoption", "ponderhit":
-		slog.Warn("not implemented", "command", name)
+	case "setoption":
+		uci.setoption(cmd)
+
+	case "ponderhit":
+		if uci.ponder == nil {
+			slog.Warn("received ponderhit without pondering")
+			return
+		}
+
+		// the search waits for the ponder channel before finishing, so set
+		// up the clock while sctx and stop still belong to this search
+		if timeout := uci.ponderTimeout; timeout > 0 {
+			slog.Debug("ponderhit, switching to timed search", "timeout", timeout)
+
+			sctx, stop := uci.sctx, uci.stop
+
+			sctx.SetDeadline(time.Now().Add(timeout))
+			time.AfterFunc(timeout, stop)
+		}
+
+		close(uci.ponder)
+		uci.ponder = nil
 
 	case "quit":
+		if uci.ponder != nil {
+			close(uci.ponder)
+			uci.ponder = nil
+		}
+
 		if uci.stop != nil {
 			uci.stop()
 		}
@@ -207,7 +393,7 @@ func (uci *UCI) position(cmd UCICommand) {
 
 	slog.Debug("setting position", "fen", fen)
 
-	game, err := GameFromFEN(fen)
+	game, err := GameFromFENOptions(fen, FENOptions{Lenient: uci.AnalyseMode})
 	if err != nil {
 		slog.Warn("invalid position", "error", err)
 		return
@@ -215,8 +401,8 @@ func (uci *UCI) position(cmd UCICommand) {
 
 	if moves := slices.Index(cmd, "moves"); moves != -1 {
 		for _, move := range cmd[moves+1:] {
-			if !game.MakeUCIMove(move) {
-				slog.Warn("invalid move", "move", move)
+			if err := game.MakeUCIMove(move); err != nil {
+				slog.Warn("rejecting position", "error", err)
 				return
 			}
 		}
@@ -225,86 +411,288 @@ func (uci *UCI) position(cmd UCICommand) {
 	uci.game = game
 }
 
-func (uci *UCI) search(ctx context.Context) {
-	uci.sctx = &SearchContext{
-		Context: ctx,
-		Game:    uci.game,
-		TT:      uci.tt,
+func (uci *UCI) setoption(cmd UCICommand) {
+	if uci.sctx != nil {
+		slog.Warn("cannot set option while searching", "command", cmd)
+		return
+	}
+
+	start := slices.Index(cmd, "name")
+	if start == -1 {
+		slog.Warn("missing option name", "command", cmd)
+		return
+	}
+
+	name, value := strings.Join(cmd[start+1:], " "), ""
+
+	if end := slices.Index(cmd, "value"); end > start {
+		name = strings.Join(cmd[start+1:end], " ")
+		value = strings.Join(cmd[end+1:], " ")
+	}
+
+	if err := uci.options.Set(name, value); err != nil {
+		slog.Warn("failed to set option", "error", err)
+		return
+	}
+
+	slog.Debug("set option", "name", name, "value", value)
+}
+
+func (uci *UCI) limits(cmd UCICommand) SearchLimits {
+	limits := SearchLimits{}
+
+	limits.Depth, _ = cmd.IntArg("depth")
+	limits.Nodes, _ = cmd.IntArg("nodes")
+	limits.Mate, _ = cmd.IntArg("mate")
+
+	if start := slices.Index(cmd, "searchmoves"); start != -1 {
+		for _, arg := range cmd[start+1:] {
+			if slices.Contains(UCIGoArgs, arg) {
+				break
+			}
+
+			move, err := ParseUCIMove(uci.game.Board(), arg)
+			if err != nil {
+				slog.Warn("ignoring invalid searchmove", "error", err)
+				continue
+			}
+
+			limits.Moves = append(limits.Moves, move)
+		}
 	}
 
+	return limits
+}
+
+func (uci *UCI) timeout(cmd UCICommand) time.Duration {
+	timeout := time.Duration(0)
+
+	if mtime, ok := cmd.DurationArg("movetime"); ok {
+		timeout = mtime
+	} else if cmd.BoolArg("wtime") || cmd.BoolArg("btime") {
+		remaining := [ColorCount]time.Duration{}
+		increment := [ColorCount]time.Duration{}
+
+		remaining[White], _ = cmd.DurationArg("wtime")
+		increment[White], _ = cmd.DurationArg("winc")
+
+		remaining[Black], _ = cmd.DurationArg("btime")
+		increment[Black], _ = cmd.DurationArg("binc")
+
+		player := uci.game.Board().Player
+		remaining[player] = max(0, remaining[player]-uci.MoveOverhead)
+		timeout = remaining[player]/40 + increment[player]/2
+
+		if timeout >= remaining[player] {
+			timeout = remaining[player] - 500*time.Millisecond
+		}
+
+		if timeout < 0 {
+			timeout = 100 * time.Millisecond
+		}
+	}
+
+	if timeout == 0 {
+		timeout = uci.DefaultMoveTime
+		slog.Debug("using default movetime", "timeout", timeout)
+	} else {
+		slog.Debug("using movetime", "timeout", timeout)
+	}
+
+	return timeout
+}
+
+func (uci *UCI) search(ctx context.Context, limits SearchLimits) {
+	// the search makes moves in place, so it gets its own copy of the game
+	// and d or fen can still read the position while it runs
+	sctx := &SearchContext{
+		Context:    ctx,
+		Game:       uci.game.Clone(),
+		TT:         uci.tt,
+		Limits:     limits,
+		Threads:    uci.Threads,
+		Heuristics: uci.heuristics,
+		Options: SearchOptions{
+			PVS:                uci.PVS,
+			NullMovePruning:    uci.NullMovePruning,
+			LateMoveReductions: uci.LateMoveReductions,
+		},
+		OnIteration: uci.iteration,
+	}
+
+	ponder := uci.ponder
+	stop := uci.stop
+
+	uci.sctx = sctx
+
+	// closed once thinking is over, which may be long before a ponder search
+	// is stopped
+	done := make(chan struct{})
+
 	go func() {
 		ticker := time.NewTicker(uci.DefaultInfoInterval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			if ctx.Err() != nil {
-				break
-			}
+		for {
+			select {
+			case <-ctx.Done():
+				return
 
-			uci.info()
+			case <-done:
+				return
+
+			case <-ticker.C:
+				uci.info(sctx)
+			}
 		}
 	}()
 
 	go func() {
-		if uci.OpeningBook && len(uci.sctx.Game.Moves()) < uci.OpeningBookMoves {
-			slog.Debug("trying book move")
+		best, next := uci.think(sctx)
+		close(done)
 
-			move := RandomOpeningMove(uci.sctx.Game.Moves()...)
-			if move != nil {
-				slog.Info("using book move", "move", move)
-				uci.send("bestmove", move)
+		if ponder != nil {
+			slog.Debug("waiting for ponderhit or stop")
+			<-ponder
+		}
 
-				uci.stop()
-				uci.sctx = nil
-				uci.stop = nil
+		stop()
 
-				return
+		// clear the search before replying, so a go sent straight after
+		// bestmove isn't rejected
+		uci.mu.Lock()
+		uci.sctx = nil
+		uci.stop = nil
+		uci.mu.Unlock()
+
+		if next.IsZero() {
+			uci.send("bestmove", best)
+		} else {
+			uci.send("bestmove", best, "ponder", next)
+		}
+	}()
+}
+
+func (uci *UCI) think(sctx *SearchContext) (Move, Move) {
+	if uci.OpeningBook && len(sctx.Game.Moves()) < uci.OpeningBookMoves {
+		slog.Debug("trying book move")
+
+		if uci.book != nil {
+			if move, ok := uci.book.RandomMove(sctx.Game.Board(), uci.selector.Rand); ok {
+				slog.Info("using polyglot book move", "move", move)
+				return move, Move{}
 			}
 		}
 
-		defer func() {
-			uci.stop()
-			uci.info()
-			uci.send("bestmove", uci.sctx.Best)
+		moves, err := OpeningMoves(sctx.Game.Board())
+		if err != nil {
+			slog.Warn("ignoring opening book", "error", err)
+		}
 
-			uci.sctx = nil
-			uci.stop = nil
-		}()
+		if move := uci.selector.Select(moves); move != nil {
+			slog.Info("using book move", "move", move)
 
-		Search(uci.sctx)
-	}()
+			if m, err := ParseUCIMove(sctx.Game.Board(), move.String()); err == nil {
+				return m, Move{}
+			}
+		}
+	}
+
+	Search(sctx)
+
+	if len(sctx.PV) > 1 {
+		return sctx.Best, sctx.PV[1]
+	}
 
-	<-ctx.Done()
+	if sctx.Best.IsZero() {
+		return sctx.Best, Move{}
+	}
+
+	sctx.Game.MakeMove(sctx.Best)
+	defer sctx.Game.UnmakeMove()
+
+	if t, ok := sctx.TT.Get(sctx.Game.Board().Zobrist); ok {
+		moves := GenerateMoves(sctx.Game.Board(), MoveGenerationOptions{})
+
+		if slices.Contains(moves, t.Best) {
+			return sctx.Best, t.Best
+		}
+	}
+
+	return sctx.Best, Move{}
 }
 
-func (uci *UCI) info() {
+func (uci *UCI) info(sctx *SearchContext) {
 	if !uci.debug {
 		return
 	}
 
-	if uci.sctx.CurrentMove.IsZero() {
+	if sctx.CurrentMove.IsZero() {
 		return
 	}
 
 	uci.send(
 		"info",
-		"time", time.Since(uci.sctx.Start).Milliseconds(),
-		"depth", uci.sctx.Depth,
-		"nodes", uci.sctx.Nodes,
-		"currmove", uci.sctx.CurrentMove,
+		"time", time.Since(sctx.Start).Milliseconds(),
+		"depth", sctx.Depth,
+		"nodes", sctx.Nodes(),
+		"currmove", sctx.CurrentMove,
 	)
 }
 
+func (uci *UCI) iteration(sctx *SearchContext) {
+	elapsed := time.Since(sctx.Start)
+
+	msg := []any{
+		"info",
+		"depth", sctx.Depth,
+		"seldepth", max(sctx.Depth, sctx.SelDepth),
+		"score", UCIScore(sctx.Eval),
+		"nodes", sctx.Nodes(),
+		"nps", int64(float64(sctx.Nodes()) / max(elapsed.Seconds(), 0.001)),
+		"hashfull", sctx.TT.Hashfull(),
+		"time", elapsed.Milliseconds(),
+		"pv",
+	}
+
+	for _, move := range sctx.PV {
+		msg = append(msg, move)
+	}
+
+	uci.send(msg...)
+}
+
 func (uci *UCI) send(msg ...any) {
 	slog.Debug("sending", "msg", msg)
 
+	uci.output.Lock()
+	defer uci.output.Unlock()
+
 	if _, err := fmt.Fprintln(uci.stdout, msg...); err != nil {
 		slog.Warn("failed to send", "error", err)
 	}
 }
 
+func UCIScore(eval Eval) string {
+	n, ok := eval.MateIn()
+	if !ok {
+		return fmt.Sprintf("cp %d", eval)
+	}
+
+	if eval > 0 {
+		return fmt.Sprintf("mate %d", (n+1)/2)
+	}
+
+	return fmt.Sprintf("mate %d", -n/2)
+}
+
 type UCICommand []string
 
+var UCIGoArgs = []string{
+	"searchmoves", "ponder", "wtime", "btime", "winc", "binc", "movestogo",
+	"depth", "nodes", "mate", "movetime", "infinite", "perft",
+}
+
 func UCICommandFromString(cmd string) UCICommand {
 	return strings.Fields(cmd)
 }
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUCIScore(t *testing.T) {
+	tests := map[Eval]string{
+		0:    "cp 0",
+		35:   "cp 35",
+		-120: "cp -120",
+		// too far from mate to be reported as one
+		EvalMate - 257:  "cp 999743",
+		EvalMate - 1:    "mate 1",
+		EvalMate - 3:    "mate 2",
+		-(EvalMate - 2): "mate -1",
+		-(EvalMate - 4): "mate -2",
+		-EvalMate:       "mate 0",
+	}
+
+	for eval, expected := range tests {
+		assert.Equal(t, expected, UCIScore(eval), "eval %d", eval)
+	}
+}
+
+// testOutput collects what the engine sends, which searches do from their own
+// goroutines.
+type testOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *testOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.Write(p)
+}
+
+func (o *testOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.String()
+}
+
+func (o *testOutput) BestMove() (string, bool) {
+	for _, line := range strings.Split(o.String(), "\n") {
+		if strings.HasPrefix(line, "bestmove ") {
+			return line, true
+		}
+	}
+
+	return "", false
+}
+
+func newTestUCI(t *testing.T) (*UCI, *testOutput) {
+	t.Helper()
+
+	stdout := &testOutput{}
+
+	uci := &UCI{
+		OpeningBook:         true,
+		OpeningBookMoves:    20,
+		BookPolicy:          string(OpeningPolicyUniform),
+		DefaultMoveTime:     time.Second,
+		DefaultInfoInterval: 500 * time.Millisecond,
+		MoveOverhead:        50 * time.Millisecond,
+		Hash:                1,
+		Threads:             1,
+		stdout:              stdout,
+	}
+
+	uci.init()
+
+	return uci, stdout
+}
+
+func TestUCISetOption(t *testing.T) {
+	tests := map[string]struct {
+		cmd   string
+		check func(t *testing.T, uci *UCI)
+	}{
+		"spin": {"setoption name Hash value 2", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 2, uci.Hash)
+		}},
+		"name with spaces": {"setoption name Move Overhead value 100", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 100*time.Millisecond, uci.MoveOverhead)
+		}},
+		"case insensitive": {"setoption name book policy value BEST", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, "best", uci.BookPolicy)
+			assert.Equal(t, OpeningPolicyBest, uci.selector.Policy)
+		}},
+		"check": {"setoption name OwnBook value false", func(t *testing.T, uci *UCI) {
+			assert.False(t, uci.OpeningBook)
+		}},
+		"empty string": {"setoption name BookFile value <empty>", func(t *testing.T, uci *UCI) {
+			assert.Empty(t, uci.BookFile)
+			assert.Nil(t, uci.book)
+		}},
+		"below min": {"setoption name Book Moves value -1", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 20, uci.OpeningBookMoves)
+		}},
+		"above max": {"setoption name Book Moves value 1001", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 20, uci.OpeningBookMoves)
+		}},
+		"threads": {"setoption name Threads value 4", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 4, uci.Threads)
+		}},
+		"threads above max": {"setoption name Threads value 257", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 1, uci.Threads)
+		}},
+		"not a number": {"setoption name Book Moves value many", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 20, uci.OpeningBookMoves)
+		}},
+		"not a bool": {"setoption name OwnBook value no", func(t *testing.T, uci *UCI) {
+			assert.True(t, uci.OpeningBook)
+		}},
+		"not a var": {"setoption name Book Policy value worst", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, "uniform", uci.BookPolicy)
+		}},
+		"missing name": {"setoption Book Moves value 2", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 20, uci.OpeningBookMoves)
+		}},
+		"unknown": {"setoption name Book Movez value 2", func(t *testing.T, uci *UCI) {
+			assert.Equal(t, 20, uci.OpeningBookMoves)
+		}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			uci, _ := newTestUCI(t)
+
+			uci.handle(context.Background(), UCICommandFromString(test.cmd))
+
+			test.check(t, uci)
+		})
+	}
+}
+
+func TestUCIOptionString(t *testing.T) {
+	uci, stdout := newTestUCI(t)
+
+	uci.handle(context.Background(), UCICommand{"uci"})
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+
+	assert.Equal(t, "uciok", lines[len(lines)-1])
+	assert.Contains(t, lines, "option name Hash type spin default 1 min 1 max 65536")
+	assert.Contains(t, lines, "option name Clear Hash type button")
+	assert.Contains(t, lines, "option name OwnBook type check default true")
+	assert.Contains(t, lines, "option name Book Moves type spin default 20 min 0 max 1000")
+	assert.Contains(t, lines, "option name BookFile type string default <empty>")
+	assert.Contains(t, lines, "option name Book Policy type combo default uniform var uniform var best var games var score var priority")
+}
+
+func TestUCILimits(t *testing.T) {
+	uci, _ := newTestUCI(t)
+
+	uci.position(UCICommandFromString("position startpos"))
+
+	limits := uci.limits(UCICommandFromString("go depth 5 nodes 1000 mate 3 searchmoves e2e4 d2d4 e2e5 wtime 1000"))
+
+	assert.Equal(t, SearchLimits{
+		Depth: 5,
+		Nodes: 1000,
+		Mate:  3,
+		// the illegal move is skipped and wtime ends the list
+		Moves: []Move{
+			NewMove(SquareE2, SquareE4, MoveFlagDoublePawnPush),
+			NewMove(SquareD2, SquareD4, MoveFlagDoublePawnPush),
+		},
+	}, limits)
+
+	assert.Equal(t, SearchLimits{}, uci.limits(UCICommandFromString("go infinite")))
+}
+
+func TestUCITimeout(t *testing.T) {
+	tests := map[string]struct {
+		position string
+		cmd      string
+		expected time.Duration
+	}{
+		"default":   {"position startpos", "go", time.Second},
+		"movetime":  {"position startpos", "go movetime 300", 300 * time.Millisecond},
+		"clock":     {"position startpos", "go wtime 40050 btime 1000", time.Second},
+		"increment": {"position startpos", "go wtime 10050 winc 2000", 1250 * time.Millisecond},
+		"black":     {"position startpos moves e2e4", "go wtime 1000 btime 80050", 2 * time.Second},
+		// never plan to use more than what's left on the clock
+		"increment exceeds clock": {"position startpos", "go wtime 1050 winc 2000", 500 * time.Millisecond},
+		"flagging":                {"position startpos", "go wtime 300 winc 1000", 100 * time.Millisecond},
+		"no time left":            {"position startpos", "go wtime 0 btime 1000", 100 * time.Millisecond},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			uci, _ := newTestUCI(t)
+
+			uci.position(UCICommandFromString(test.position))
+
+			assert.Equal(t, test.expected, uci.timeout(UCICommandFromString(test.cmd)))
+		})
+	}
+}
+
+func TestUCIPonder(t *testing.T) {
+	run := func(t *testing.T, uci *UCI, cmds ...string) {
+		for _, cmd := range cmds {
+			uci.handle(context.Background(), UCICommandFromString(cmd))
+		}
+	}
+
+	searching := func(uci *UCI) bool {
+		uci.mu.Lock()
+		defer uci.mu.Unlock()
+
+		return uci.sctx != nil
+	}
+
+	bestmove := func(t *testing.T, stdout *testOutput) string {
+		t.Helper()
+
+		line := ""
+
+		require.Eventually(t, func() bool {
+			var ok bool
+			line, ok = stdout.BestMove()
+			return ok
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return line
+	}
+
+	t.Run("ponderhit", func(t *testing.T) {
+		uci, stdout := newTestUCI(t)
+		uci.OpeningBook = false
+
+		run(t, uci, "position startpos moves e2e4", "go ponder wtime 4050 btime 4050")
+
+		// pondering never ends on its own
+		time.Sleep(100 * time.Millisecond)
+		_, ok := stdout.BestMove()
+		assert.False(t, ok)
+
+		run(t, uci, "ponderhit")
+
+		assert.Regexp(t, `^bestmove \w+`, bestmove(t, stdout))
+		assert.Eventually(t, func() bool { return !searching(uci) }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("ponderhit after search finished", func(t *testing.T) {
+		uci, stdout := newTestUCI(t)
+
+		run(t, uci, "position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "go ponder movetime 200")
+
+		// the mate is found straight away, and the search waits for the
+		// ponderhit with sctx and stop still set
+		time.Sleep(100 * time.Millisecond)
+		require.True(t, searching(uci))
+
+		run(t, uci, "ponderhit")
+
+		assert.Equal(t, "bestmove a1a8", bestmove(t, stdout))
+	})
+
+	t.Run("no info after search finished", func(t *testing.T) {
+		uci, stdout := newTestUCI(t)
+		uci.DefaultInfoInterval = 10 * time.Millisecond
+		uci.debug = true
+
+		run(t, uci, "position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "go ponder movetime 200")
+
+		time.Sleep(100 * time.Millisecond)
+		require.True(t, searching(uci))
+
+		sent := stdout.String()
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, sent, stdout.String())
+
+		run(t, uci, "stop")
+
+		assert.Equal(t, "bestmove a1a8", bestmove(t, stdout))
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		uci, stdout := newTestUCI(t)
+		uci.OpeningBook = false
+
+		run(t, uci, "position startpos", "go ponder infinite")
+
+		time.Sleep(50 * time.Millisecond)
+		run(t, uci, "stop")
+
+		assert.Regexp(t, `^bestmove \w+`, bestmove(t, stdout))
+		assert.Eventually(t, func() bool { return !searching(uci) }, time.Second, 10*time.Millisecond)
+
+		// a new search can start once bestmove has been sent
+		run(t, uci, "go depth 1")
+		assert.True(t, searching(uci))
+	})
+
+	t.Run("ponderhit without ponder", func(t *testing.T) {
+		uci, stdout := newTestUCI(t)
+
+		run(t, uci, "position startpos", "ponderhit")
+
+		assert.Empty(t, stdout.String())
+	})
+}
+
+func TestUCIFENDuringSearch(t *testing.T) {
+	uci, stdout := newTestUCI(t)
+	uci.OpeningBook = false
+
+	const fen = "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"
+
+	handle := func(cmd string) {
+		uci.handle(context.Background(), UCICommandFromString(cmd))
+	}
+
+	handle("position startpos moves e2e4 e7e5 g1f3 b8c6")
+	handle("go infinite")
+
+	// the search is making moves the whole time, none of which should show
+	for range 20 {
+		handle("fen")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	handle("stop")
+
+	require.Eventually(t, func() bool {
+		_, ok := stdout.BestMove()
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	fens := 0
+
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if strings.Contains(line, "/") && !strings.HasPrefix(line, "info") {
+			assert.Equal(t, fen, line)
+			fens++
+		}
+	}
+
+	assert.Equal(t, 20, fens)
+}
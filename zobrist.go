@@ -59,7 +59,9 @@ func CalculateZobrist(b *Board) Zobrist {
 		zobrist ^= Zobrists.Pieces[piece.Color()][piece.Type()][src]
 	}
 
-	zobrist ^= Zobrists.EnPassant[b.EnPassant]
+	if b.EnPassant != 0 {
+		zobrist ^= Zobrists.EnPassant[b.EnPassant]
+	}
 
 	return zobrist
 }
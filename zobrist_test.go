@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZobristIncremental(t *testing.T) {
+	data, err := os.ReadFile("testdata/perft.json")
+	require.NoError(t, err)
+
+	tests := map[string][]uint64(nil)
+	require.NoError(t, json.Unmarshal(data, &tests))
+
+	var walk func(t *testing.T, b Board, depth int)
+
+	walk = func(t *testing.T, b Board, depth int) {
+		require.Equal(t, CalculateZobrist(&b), b.Zobrist)
+
+		if depth == 0 {
+			return
+		}
+
+		// null moves have to clear the en passant square the same way
+		null := b.MakeNullMove()
+		require.Equal(t, CalculateZobrist(&null), null.Zobrist)
+
+		for _, move := range GenerateMoves(&b, MoveGenerationOptions{}) {
+			walk(t, b.MakeMove(move), depth-1)
+		}
+	}
+
+	for fen := range tests {
+		t.Run(fen, func(t *testing.T) {
+			b, err := BoardFromFEN(fen)
+			require.NoError(t, err)
+
+			walk(t, b, 3)
+		})
+	}
+}